@@ -1,58 +1,191 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/Hentra/dyndns-netcup-go/internal"
 )
 
 const (
-	configFileLocation = "/config.yml"
-	ipCacheLocation    = "/ipcache"
-	defaultInterval    = time.Minute
-	intervalEnv        = "INTERVAL"
+	configFileLocation  = "/config.yml"
+	ipCacheLocation     = "/ipcache"
+	defaultInterval     = time.Minute
+	defaultPollInterval = 10 * time.Second
+	intervalEnv         = "INTERVAL"
+	pollIntervalEnv     = "CONFIG_POLL_INTERVAL"
 )
 
+// daemon configures the DNS records periodically and reloads the config when
+// it changes.
+type daemon struct {
+	loader       *internal.ConfigLoader
+	config       *internal.Config
+	stamp        string
+	configurator *internal.DNSConfiguratorService
+	logger       *internal.Logger
+	// cache is loaded again before every run, so changes of other
+	// processes like a 'cache clear' are not overwritten.
+	cache *internal.Cache
+}
+
 func main() {
-	interval, err := parseEnv()
+	interval, err := parseEnv(intervalEnv, defaultInterval)
 	if err != nil {
 		log.Fatal("Could not parse interval: ", err)
 	}
 
+	pollInterval, err := parseEnv(pollIntervalEnv, defaultPollInterval)
+	if err != nil {
+		log.Fatal("Could not parse config poll interval: ", err)
+	}
+
 	logger := internal.NewLogger(true)
 
-	config, err := internal.LoadConfig(configFileLocation)
+	d := &daemon{
+		loader: internal.NewConfigLoader(configFileLocation, true, logger),
+		logger: logger,
+	}
+
+	d.config, err = d.load()
+	d.stamp = d.loader.Stamp()
 	if err != nil {
-		logger.Error("Error loading config file. Make sure a config file is mounted to ", configFileLocation, ":", err)
+		logger.Error("Error loading config. Mount a config file to ", configFileLocation,
+			" or set the DYNDNS_* environment variables: ", err)
+	}
+
+	if d.config.CacheEnabled() {
+		store, err := internal.NewStateStore(d.config.IPCacheBackend, d.config.IPCache)
+		if err != nil {
+			logger.Error(err)
+		}
+
+		d.cache = internal.NewCache(store, time.Second*time.Duration(d.config.IPCacheTimeout))
+		defer d.cache.Close()
+
+		// The cache is loaded once to report a broken cache on startup.
+		err = d.cache.Load()
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	d.configurator = internal.NewDNSConfigurator(d.config, d.cache, logger)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	// A nil channel blocks forever, so without a ticker nothing is polled.
+	var poll <-chan time.Time
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case <-timer.C:
+		case <-hangup:
+			logger.Info("Received SIGHUP, reloading config")
+			if !d.reload() {
+				continue
+			}
+		case <-poll:
+			if d.loader.Stamp() == d.stamp {
+				continue
+			}
+			logger.Info("Config changed, reloading")
+			if !d.reload() {
+				continue
+			}
+		}
+
+		d.configure()
+		timer.Reset(interval)
+	}
+}
+
+// load loads the config from all layers.
+func (d *daemon) load() (*internal.Config, error) {
+	config, err := d.loader.Load()
+	if err != nil {
+		return nil, err
 	}
 
 	config.IPCache = ipCacheLocation
+	return config, nil
+}
 
-	cache, err := internal.NewCache(config.IPCache, time.Second*time.Duration(config.IPCacheTimeout))
+// reload loads the config again and swaps it into the configurator if it is
+// valid. Otherwise the current config is kept. It returns whether the config
+// was replaced.
+func (d *daemon) reload() bool {
+	// The stamp is taken after loading because it covers the included files
+	// of the loaded config.
+	config, err := d.load()
+	d.stamp = d.loader.Stamp()
 	if err != nil {
-		logger.Error(err)
+		d.logger.Warning("Keeping the current config because the new one is invalid: %v", err)
+		return false
 	}
 
-	configurator := internal.NewDNSConfigurator(config, cache, logger)
-	for {
-		logger.Info("configure DNS records")
-		configurator.Configure()
-		time.Sleep(interval)
+	changes := internal.DiffDomains(d.config, config)
+	if len(changes) == 0 {
+		d.logger.Info("Config reloaded, no domains or hosts changed")
+	}
+	for _, change := range changes {
+		d.logger.Info("Config reloaded: %s", change)
 	}
+
+	if d.config.IPCacheTimeout != config.IPCacheTimeout || d.config.IPCacheBackend != config.IPCacheBackend {
+		d.logger.Warning("Changes of the cache settings take effect after a restart")
+	}
+
+	d.config = config
+	d.configurator.SetConfig(config)
+	return true
 }
 
-func parseEnv() (time.Duration, error) {
-	intervalTime := defaultInterval
-	if interval, exists := os.LookupEnv(intervalEnv); exists {
-		intervalSeconds, err := strconv.Atoi(interval)
-		if err != nil {
-			return 0, err
+func (d *daemon) configure() {
+	d.logger.Info("configure DNS records")
+
+	if d.cache != nil {
+		if err := d.cache.Load(); err != nil {
+			d.logger.Warning("Configuration failed: %v", err)
+			return
 		}
-		intervalTime = time.Duration(intervalSeconds) * time.Second
+		defer d.cache.Release()
+	}
+
+	err := d.configurator.Configure()
+
+	var runErr *internal.RunError
+	if errors.As(err, &runErr) {
+		d.logger.Warning("Configuration finished with %d failure(s)", len(runErr.Errors))
+	} else if err != nil {
+		d.logger.Warning("Configuration failed: %v", err)
+	}
+}
+
+// parseEnv returns the number of seconds in an environment variable as
+// duration or a default value if it is not set.
+func parseEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
 	}
 
-	return intervalTime, nil
+	return time.Duration(seconds) * time.Second, nil
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+)
+
+const testConfig = `CUSTOMERNR: 1
+APIKEY: key
+APIPASSWORD: password
+DOMAINS:
+  - NAME: example.de
+    TTL: 300
+    HOSTS: [www]
+`
+
+func TestDaemonReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, file, testConfig)
+
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	logger := internal.NewLogger(true)
+	d := &daemon{
+		loader: &internal.ConfigLoader{File: file, Logger: logger},
+		logger: logger,
+	}
+
+	var err error
+	d.config, err = d.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.stamp = d.loader.Stamp()
+	d.configurator = internal.NewDNSConfigurator(d.config, nil, logger)
+
+	// An invalid config is not used, but its stamp is taken so it is not
+	// loaded again until it changes.
+	current := d.config
+	writeConfig(t, file, strings.Replace(testConfig, "TTL: 300", "TTL: 0", 1))
+	if d.reload() {
+		t.Error("reload() of an invalid config = true")
+	}
+	if d.config != current {
+		t.Error("reload() replaced the config with an invalid one")
+	}
+	if d.stamp != d.loader.Stamp() {
+		t.Error("reload() did not take the stamp of the invalid config")
+	}
+	if !strings.Contains(buf.String(), "Keeping the current config because the new one is invalid") {
+		t.Errorf("output = %q, want a warning about the invalid config", buf.String())
+	}
+
+	writeConfig(t, file, strings.Replace(testConfig, "HOSTS: [www]", "HOSTS: [www, vpn]", 1))
+	if !d.reload() {
+		t.Fatal("reload() of a valid config = false")
+	}
+	if d.config == current || len(d.config.Domains[0].Hosts) != 2 {
+		t.Errorf("reload() did not replace the config, hosts = %v", d.config.Domains[0].HostNames())
+	}
+	if d.config.IPCache != ipCacheLocation {
+		t.Errorf("IP-CACHE = %s, want %s", d.config.IPCache, ipCacheLocation)
+	}
+	if !strings.Contains(buf.String(), "Config reloaded: added host vpn to domain example.de") {
+		t.Errorf("output = %q, want the changes of the config", buf.String())
+	}
+}
+
+func writeConfig(t *testing.T, file, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
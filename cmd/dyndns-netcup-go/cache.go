@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+const cacheUsage = `Usage: dyndns-netcup-go [flags] cache <command>
+
+Commands:
+  show          Show all cache entries
+  clear [host]  Remove all entries or only the entries of a host
+  export        Write the whole cache as JSON to stdout
+  verify        Compare the cache with the records at netcup and report drift
+`
+
+// runCache runs a cache subcommand and returns the exit status.
+func runCache(args []string, cmdConfig *cmdConfig, config *internal.Config, logger *internal.Logger) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return 1
+	}
+
+	if !config.CacheEnabled() {
+		logger.Warning("The cache is disabled in the config")
+	}
+
+	runLock, err := acquireRunLock(cmdConfig)
+	if err != nil {
+		logger.Error(err)
+	}
+	defer runLock.Release()
+
+	cache, err := openCache(config)
+	if err != nil {
+		logger.Error(err)
+	}
+	defer cache.Close()
+
+	switch args[0] {
+	case "show":
+		showCache(cache)
+	case "clear":
+		var host string
+		if len(args) > 1 {
+			host = args[1]
+		}
+		err = clearCache(cache, host)
+	case "export":
+		err = cache.Export(os.Stdout)
+	case "verify":
+		return verifyCache(cache, config, logger)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache command '%s'\n\n%s", args[0], cacheUsage)
+		return 1
+	}
+
+	if err != nil {
+		logger.Error(err)
+	}
+
+	return 0
+}
+
+func showCache(cache *internal.Cache) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tTYPE\tVALUE\tRECORD ID\tLAST VERIFIED\tLAST CHANGED")
+
+	for _, entry := range sortedEntries(cache) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.FQDN(), entry.Type, entry.Value, entry.RecordID,
+			formatTime(entry.LastVerified), formatTime(entry.LastChanged))
+	}
+	w.Flush()
+
+	if lastRun := cache.LastRun(); lastRun != nil {
+		fmt.Printf("\nLast run: %s (%d failure(s))\n", formatTime(lastRun.Finished), len(lastRun.Failures))
+		for _, failure := range lastRun.Failures {
+			fmt.Printf("  %s\n", failure)
+		}
+	}
+}
+
+func clearCache(cache *internal.Cache, host string) error {
+	removed := cache.Clear(host)
+	if err := cache.Store(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d entries\n", removed)
+	return nil
+}
+
+// verifyCache compares the cached values with the records at netcup. It
+// returns 1 if any drift was found.
+func verifyCache(cache *internal.Cache, config *internal.Config, logger *internal.Logger) int {
+	entries := cache.Entries()
+	domains := make(map[string]bool)
+	for _, entry := range entries {
+		domains[entry.Domain] = true
+	}
+
+	status := 0
+	clients := make(map[string]*netcup.Client)
+	for _, domain := range sortedKeys(domains) {
+		client, err := accountClient(clients, config, domain)
+		if err != nil {
+			logger.Warning("domain %s: %v", domain, err)
+			status = 1
+			continue
+		}
+
+		records, err := client.InfoDNSRecords(domain)
+		if err != nil {
+			logger.Warning("domain %s: loading records: %v", domain, err)
+			status = 1
+			continue
+		}
+
+		drifts := internal.FindDrift(domain, entries, records)
+		for _, drift := range drifts {
+			fmt.Printf("DRIFT %s %s: cached %s, netcup %s\n", drift.Entry.FQDN(), drift.Entry.Type, drift.Entry.Value, drift.Remote)
+		}
+
+		if len(drifts) > 0 {
+			status = 1
+		} else {
+			fmt.Printf("OK    %s\n", domain)
+		}
+	}
+
+	return status
+}
+
+// accountClient returns a logged in client for the account of a domain.
+// Domains that are no longer configured are looked up in the default
+// account. Clients are reused for all domains of an account.
+func accountClient(clients map[string]*netcup.Client, config *internal.Config, domain string) (*netcup.Client, error) {
+	name := internal.DefaultAccount
+	for _, configured := range config.Domains {
+		if configured.Name == domain {
+			name = configured.AccountName()
+		}
+	}
+
+	if client, ok := clients[name]; ok {
+		return client, nil
+	}
+
+	account, ok := config.Account(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown account '%s'", name)
+	}
+
+	client := account.NewClient()
+	if err := client.Login(); err != nil {
+		return nil, fmt.Errorf("account %s: login: %w", name, err)
+	}
+	clients[name] = client
+
+	return client, nil
+}
+
+func sortedEntries(cache *internal.Cache) []internal.CacheEntry {
+	entries := append([]internal.CacheEntry(nil), cache.Entries()...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Domain != entries[j].Domain {
+			return entries[i].Domain < entries[j].Domain
+		}
+		if entries[i].Host != entries[j].Host {
+			return entries[i].Host < entries[j].Host
+		}
+		return entries[i].Type < entries[j].Type
+	})
+
+	return entries
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.RFC3339)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+	"gopkg.in/yaml.v3"
+)
+
+const configCmdUsage = `Usage: dyndns-netcup-go [flags] config <command>
+
+Commands:
+  dump [--effective]  Write the config loaded from all layers as YAML to stdout.
+                      With --effective the defaults are applied and every
+                      domain and host lists all of its settings
+`
+
+// runConfig runs a config subcommand and returns the exit status.
+func runConfig(args []string, config *internal.Config, logger *internal.Logger) int {
+	if len(args) == 0 || args[0] != "dump" {
+		fmt.Fprint(os.Stderr, configCmdUsage)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("config dump", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, configCmdUsage) }
+	effective := flags.Bool("effective", false, "Show the fully resolved config")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	if err := dumpConfig(os.Stdout, config, *effective); err != nil {
+		logger.Error(err)
+	}
+
+	return 0
+}
+
+// dumpConfig writes the config as YAML. With effective the defaults are
+// applied first. Secrets are redacted by the encoder.
+func dumpConfig(w io.Writer, config *internal.Config, effective bool) error {
+	if effective {
+		config = config.Effective()
+	}
+
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+)
+
+func TestDumpConfigEffective(t *testing.T) {
+	config, err := (&internal.ConfigLoader{File: filepath.Join("testdata", "config.yml")}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := dumpConfig(&buf, config, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The golden file shows the defaults applied to the keys the domains do
+	// not set and the secrets and credential headers redacted.
+	want, err := os.ReadFile(filepath.Join("testdata", "config-effective.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != string(want) {
+		t.Errorf("dumpConfig() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("secret-key")) || bytes.Contains(buf.Bytes(), []byte("Bearer token")) {
+		t.Error("dumpConfig() revealed a secret")
+	}
+}
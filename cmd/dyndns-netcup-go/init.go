@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	initUsage = `Usage: dyndns-netcup-go [flags] init [file]
+
+Asks for your netcup credentials, lets you pick the domains and hosts to
+update and writes the config to file. The file defaults to the -config flag.
+`
+
+	defaultInitTTL = 300
+)
+
+var errAborted = errors.New("aborted")
+
+// initConfig is the config written by init. It contains the credentials in
+// plain text, unlike an encoded internal.Config.
+type initConfig struct {
+	CustomerNumber int          `yaml:"CUSTOMERNR"`
+	APIKey         string       `yaml:"APIKEY"`
+	APIPassword    string       `yaml:"APIPASSWORD"`
+	Domains        []initDomain `yaml:"DOMAINS"`
+}
+
+type initDomain struct {
+	Name  string   `yaml:"NAME"`
+	IPv6  bool     `yaml:"IPV6"`
+	IPv4  bool     `yaml:"IPV4"`
+	TTL   int      `yaml:"TTL"`
+	Hosts []string `yaml:"HOSTS"`
+}
+
+// prompter asks the user for input on the terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// terminal is the file descriptor of stdin if it is a terminal and -1
+	// otherwise. Secrets are only read without echo from a terminal.
+	terminal int
+}
+
+// runInit runs the init command and returns the exit status.
+func runInit(args []string, cmdConfig *cmdConfig, logger *internal.Logger) int {
+	if len(args) > 1 {
+		fmt.Fprint(os.Stderr, initUsage)
+		return 1
+	}
+
+	filename := cmdConfig.ConfigFile
+	if len(args) == 1 {
+		filename = args[0]
+	}
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout, terminal: -1}
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		p.terminal = fd
+	}
+
+	config, err := p.buildConfig(filename)
+	if errors.Is(err, errAborted) {
+		fmt.Fprintln(p.out, "Nothing was written")
+		return 1
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	// The file contains the credentials, so only the owner may read it.
+	err = os.WriteFile(filename, content, 0600)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	fmt.Fprintf(p.out, "\nWrote %s. Run dyndns-netcup-go -config %s -v to update your records.\n", filename, filename)
+	return 0
+}
+
+func (p *prompter) buildConfig(filename string) (*initConfig, error) {
+	if _, err := os.Stat(filename); err == nil {
+		overwrite, err := p.confirm(fmt.Sprintf("%s already exists. Overwrite it?", filename), false)
+		if err != nil {
+			return nil, err
+		}
+		if !overwrite {
+			return nil, errAborted
+		}
+	}
+
+	config := &initConfig{}
+	client, err := p.login(config)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := p.domains(client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range domains {
+		domain, err := p.domain(client, name)
+		if err != nil {
+			return nil, err
+		}
+		if domain != nil {
+			config.Domains = append(config.Domains, *domain)
+		}
+	}
+
+	if len(config.Domains) == 0 {
+		fmt.Fprintln(p.out, "No domain was selected")
+		return nil, errAborted
+	}
+
+	if err := validateInitConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// login asks for the credentials until the login succeeds.
+func (p *prompter) login(config *initConfig) (*netcup.Client, error) {
+	fmt.Fprintln(p.out, "Enter the credentials of your netcup account. API key and password are created")
+	fmt.Fprintln(p.out, "in the CCP under Master Data > API.")
+
+	for {
+		number, err := p.ask("Customer number", "")
+		if err != nil {
+			return nil, err
+		}
+
+		config.CustomerNumber, err = strconv.Atoi(number)
+		if err != nil || config.CustomerNumber <= 0 {
+			fmt.Fprintf(p.out, "'%s' is not a customer number\n", number)
+			continue
+		}
+
+		if config.APIKey, err = p.askSecret("API key"); err != nil {
+			return nil, err
+		}
+
+		if config.APIPassword, err = p.askSecret("API password"); err != nil {
+			return nil, err
+		}
+
+		client := netcup.NewClient(config.CustomerNumber, config.APIKey, config.APIPassword)
+		if err := client.Login(); err != nil {
+			fmt.Fprintf(p.out, "Login failed: %v\n\n", err)
+			continue
+		}
+
+		return client, nil
+	}
+}
+
+// domains returns the domains of the account. If the account doesn't allow
+// to list them, the user enters them.
+func (p *prompter) domains(client *netcup.Client) ([]string, error) {
+	domains, err := client.ListAllDomains()
+	if err == nil && len(domains) > 0 {
+		sort.Strings(domains)
+		return domains, nil
+	}
+
+	if err != nil {
+		fmt.Fprintf(p.out, "\nThe domains of the account could not be listed (%v).\n", err)
+	}
+
+	for {
+		answer, err := p.ask("Domains to configure (comma separated, e.g. example.de)", "")
+		if err != nil {
+			return nil, err
+		}
+
+		if domains := splitList(answer); len(domains) > 0 {
+			return domains, nil
+		}
+	}
+}
+
+// domain shows the A and AAAA records of a domain and asks how to configure
+// it. It returns nil if the domain should not be configured.
+func (p *prompter) domain(client *netcup.Client, name string) (*initDomain, error) {
+	fmt.Fprintf(p.out, "\n== %s ==\n", name)
+
+	zone, err := client.InfoDNSZone(name)
+	if err != nil {
+		fmt.Fprintf(p.out, "The zone could not be loaded: %v\n", err)
+		return nil, nil
+	}
+
+	recordSet, err := client.InfoDNSRecords(name)
+	if err != nil {
+		fmt.Fprintf(p.out, "The records could not be loaded: %v\n", err)
+		return nil, nil
+	}
+
+	var hosts []string
+	hasA, hasAAAA := false, false
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tTYPE\tDESTINATION")
+	for _, record := range recordSet.DNSRecords {
+		if record.Type != "A" && record.Type != "AAAA" {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", record.Hostname, record.Type, record.Destination)
+		if !internal.Contains(hosts, record.Hostname) {
+			hosts = append(hosts, record.Hostname)
+		}
+		hasA = hasA || record.Type == "A"
+		hasAAAA = hasAAAA || record.Type == "AAAA"
+	}
+
+	if len(hosts) == 0 {
+		fmt.Fprintln(p.out, "The zone has no A or AAAA records yet.")
+	} else {
+		w.Flush()
+	}
+
+	configure, err := p.confirm(fmt.Sprintf("Update records of %s?", name), true)
+	if err != nil || !configure {
+		return nil, err
+	}
+
+	domain := &initDomain{Name: name}
+
+	fmt.Fprintln(p.out, "Hosts are relative to the domain: '@' is the domain itself, '*' matches all")
+	fmt.Fprintf(p.out, "subdomains and 'www' is www.%s.\n", name)
+	if domain.Hosts, err = p.hosts(name, hosts); err != nil {
+		return nil, err
+	}
+
+	for {
+		if domain.IPv4, err = p.confirm("Update A records (IPv4)?", hasA || !hasAAAA); err != nil {
+			return nil, err
+		}
+
+		if domain.IPv6, err = p.confirm("Update AAAA records (IPv6)?", hasAAAA); err != nil {
+			return nil, err
+		}
+
+		if domain.IPv4 || domain.IPv6 {
+			break
+		}
+		fmt.Fprintln(p.out, "At least one of IPv4 and IPv6 must be updated")
+	}
+
+	ttl := defaultInitTTL
+	if zoneTTL, err := strconv.Atoi(zone.TTL); err == nil && zoneTTL > 0 {
+		ttl = zoneTTL
+	}
+
+	for {
+		answer, err := p.ask("TTL of the zone in seconds", strconv.Itoa(ttl))
+		if err != nil {
+			return nil, err
+		}
+
+		domain.TTL, err = strconv.Atoi(answer)
+		if err == nil && domain.TTL > 0 {
+			return domain, nil
+		}
+		fmt.Fprintf(p.out, "'%s' is not a valid TTL\n", answer)
+	}
+}
+
+// hosts asks for the hosts of a domain until all of them are valid.
+func (p *prompter) hosts(domain string, existing []string) ([]string, error) {
+	defaultHosts := strings.Join(existing, ",")
+	if defaultHosts == "" {
+		defaultHosts = "@"
+	}
+
+	for {
+		answer, err := p.ask("Hosts to update (comma separated)", defaultHosts)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts := splitList(answer)
+		valid := len(hosts) > 0
+		for _, host := range hosts {
+			if err := internal.CheckHost(host, domain); err != nil {
+				fmt.Fprintf(p.out, "%s\n", err)
+				valid = false
+			}
+		}
+
+		if valid {
+			return hosts, nil
+		}
+	}
+}
+
+// ask asks a question and returns the answer or a default value if the
+// answer is empty.
+func (p *prompter) ask(question, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errAborted
+		}
+		return "", err
+	}
+
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+
+	return defaultValue, nil
+}
+
+// askSecret asks for a secret without echoing it if stdin is a terminal.
+// Input that was already read into the reader, like pasted lines, is used
+// first, because the terminal is read directly.
+func (p *prompter) askSecret(question string) (string, error) {
+	if p.terminal < 0 || p.in.Buffered() > 0 {
+		return p.ask(question, "")
+	}
+
+	fmt.Fprintf(p.out, "%s: ", question)
+	secret, err := term.ReadPassword(p.terminal)
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// confirm asks a yes/no question.
+func (p *prompter) confirm(question string, defaultValue bool) (bool, error) {
+	options := "y/N"
+	if defaultValue {
+		options = "Y/n"
+	}
+
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s [%s]", question, options), "")
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(answer) {
+		case "":
+			return defaultValue, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// validateInitConfig validates the config as it would be loaded.
+func validateInitConfig(config *initConfig) error {
+	validated := &internal.Config{
+		CustomerNumber: config.CustomerNumber,
+		APIKey:         internal.Secret(config.APIKey),
+		APIPassword:    internal.Secret(config.APIPassword),
+	}
+
+	for _, domain := range config.Domains {
+		var hosts []internal.Host
+		for _, host := range domain.Hosts {
+			hosts = append(hosts, internal.Host{Name: host})
+		}
+
+		validated.Domains = append(validated.Domains, internal.Domain{
+			Name:  domain.Name,
+			IPv4:  domain.IPv4,
+			IPv6:  domain.IPv6,
+			TTL:   domain.TTL,
+			Hosts: hosts,
+		})
+	}
+
+	return validated.Validate()
+}
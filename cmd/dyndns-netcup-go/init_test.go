@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPrompterPipedInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		terminal int
+	}{
+		{name: "not a terminal", terminal: -1},
+		// Lines pasted into a terminal are buffered by the reader and must
+		// not be skipped by reading the terminal directly.
+		{name: "buffered terminal input", terminal: 1000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &prompter{
+				in:       bufio.NewReader(strings.NewReader("12345\nkey\npassword\n")),
+				out:      io.Discard,
+				terminal: test.terminal,
+			}
+
+			customer, err := p.ask("Customer number", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := p.askSecret("API key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			password, err := p.askSecret("API password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if customer != "12345" || key != "key" || password != "password" {
+				t.Errorf("answers = %q, %q, %q, want 12345, key, password", customer, key, password)
+			}
+
+			if test.terminal >= 0 {
+				return
+			}
+			if _, err := p.askSecret("API password"); err != errAborted {
+				t.Errorf("askSecret() at the end of the input error = %v, want %v", err, errAborted)
+			}
+		})
+	}
+}
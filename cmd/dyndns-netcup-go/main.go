@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/Hentra/dyndns-netcup-go/internal"
@@ -11,11 +16,61 @@ const (
 	defaultConfigFile = "config.yml"
 	configUsage       = "Specify location of the config file"
 	verboseUsage      = "Use verbose output"
+	ipv4Usage         = "Publish the specified IPv4 address instead of detecting it. Use 'remove' to delete the A records"
+	ipv6Usage         = "Publish the specified IPv6 address instead of detecting it. Use 'remove' to delete the AAAA records"
+	stdinUsage        = "Read the addresses to publish from stdin (e.g. '1.2.3.4 2001:db8::1' or 'ipv6=remove')"
+	domainsUsage      = "Comma separated list of domains to configure. Defaults to all configured domains"
+	hostsUsage        = "Comma separated list of hosts to configure. Defaults to all configured hosts"
+	lockFileUsage     = "Specify location of the lock file that prevents concurrent runs. Defaults to the user cache dir"
+	lockWaitUsage     = "Time to wait for a concurrent run to finish before exiting (e.g. 30s)"
+	setUsage          = "Override a config key (e.g. 'IP-CACHE-TIMEOUT=300'). Can be repeated"
+
+	// exitPartialFailure is the exit status when only some of the domains
+	// or records could be configured.
+	exitPartialFailure = 2
 )
 
+const commandsUsage = `Without a command the DNS records are configured as specified by the config.
+
+Commands:
+  init [file]         Create a config interactively from your netcup account
+  cache show          Show all cache entries
+  cache clear [host]  Remove all entries or only the entries of a host
+  cache export        Write the whole cache as JSON to stdout
+  cache verify        Compare the cache with the records at netcup and report drift
+  config dump         Show the config loaded from all layers
+  config dump --effective
+                      Show the config with all defaults resolved
+`
+
+var errNoStdinAddress = errors.New("no ip address was read from stdin")
+
 type cmdConfig struct {
 	ConfigFile string
 	Verbose    bool
+	IPv4       string
+	IPv6       string
+	Stdin      bool
+	Domains    string
+	Hosts      string
+	LockFile   string
+	LockWait   time.Duration
+	Overrides  stringList
+
+	// configFileSet is true if the config file was specified explicitly.
+	configFileSet bool
+}
+
+// stringList is a flag that can be specified multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
@@ -23,18 +78,119 @@ func main() {
 
 	logger := internal.NewLogger(cmdConfig.Verbose)
 
-	config, err := internal.LoadConfig(cmdConfig.ConfigFile)
+	// init creates the config, so it must not be loaded before.
+	if flag.Arg(0) == "init" {
+		os.Exit(runInit(flag.Args()[1:], cmdConfig, logger))
+	}
+
+	loader := internal.NewConfigLoader(cmdConfig.ConfigFile, !cmdConfig.configFileSet, logger)
+	loader.Overrides = cmdConfig.Overrides
+
+	config, err := loader.Load()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args(), cmdConfig, config, logger))
+	}
+
+	err = config.Select(splitList(cmdConfig.Domains), splitList(cmdConfig.Hosts))
 	if err != nil {
 		logger.Error(err)
 	}
 
-	cache, err := internal.NewCache(config.IPCache, time.Second*time.Duration(config.IPCacheTimeout))
+	addrInfo, err := cmdConfig.addrInfo(os.Stdin)
 	if err != nil {
 		logger.Error(err)
 	}
 
+	os.Exit(configure(cmdConfig, config, addrInfo, logger))
+}
+
+// runCommand runs a subcommand and returns the exit status.
+func runCommand(args []string, cmdConfig *cmdConfig, config *internal.Config, logger *internal.Logger) int {
+	switch args[0] {
+	case "cache":
+		return runCache(args[1:], cmdConfig, config, logger)
+	case "config":
+		return runConfig(args[1:], config, logger)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n", args[0])
+		flag.Usage()
+		return 1
+	}
+}
+
+// configure runs the configurator and returns the exit status.
+func configure(cmdConfig *cmdConfig, config *internal.Config, addrInfo *internal.AddrInfo, logger *internal.Logger) int {
+	runLock, err := acquireRunLock(cmdConfig)
+	if errors.Is(err, internal.ErrLocked) {
+		logger.Warning("Another run is in progress. Exiting")
+		return 0
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+	defer runLock.Release()
+
+	var cache *internal.Cache
+	if config.CacheEnabled() {
+		cache, err = openCache(config)
+		if err != nil {
+			logger.Error(err)
+		}
+		defer cache.Close()
+	}
+
 	configurator := internal.NewDNSConfigurator(config, cache, logger)
-	configurator.Configure()
+	if addrInfo != nil {
+		configurator.SetAddrInfo(addrInfo)
+	}
+	err = configurator.Configure()
+
+	var runErr *internal.RunError
+	if errors.As(err, &runErr) {
+		logger.Warning("Configuration finished with %d failure(s)", len(runErr.Errors))
+	} else if err != nil {
+		logger.Error(err)
+	}
+
+	return exitStatus(err)
+}
+
+// exitStatus returns the exit status for the result of a run. A RunError
+// means that only some records could be configured, any other error that
+// none could be configured.
+func exitStatus(err error) int {
+	var runErr *internal.RunError
+	if errors.As(err, &runErr) {
+		return exitPartialFailure
+	}
+
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// openCache opens and loads the cache as specified by the config.
+func openCache(config *internal.Config) (*internal.Cache, error) {
+	store, err := internal.NewStateStore(config.IPCacheBackend, config.IPCache)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := internal.NewCache(store, time.Second*time.Duration(config.IPCacheTimeout))
+
+	err = cache.Load()
+	if err != nil {
+		cache.Close()
+		return nil, err
+	}
+
+	return cache, nil
 }
 
 func parseCmd() *cmdConfig {
@@ -45,7 +201,90 @@ func parseCmd() *cmdConfig {
 	flag.BoolVar(&cmdConfig.Verbose, "verbose", false, verboseUsage)
 	flag.BoolVar(&cmdConfig.Verbose, "v", false, verboseUsage+" (shorthand)")
 
+	flag.StringVar(&cmdConfig.IPv4, "ipv4", "", ipv4Usage)
+	flag.StringVar(&cmdConfig.IPv6, "ipv6", "", ipv6Usage)
+	flag.BoolVar(&cmdConfig.Stdin, "stdin", false, stdinUsage)
+	flag.StringVar(&cmdConfig.Domains, "domains", "", domainsUsage)
+	flag.StringVar(&cmdConfig.Hosts, "hosts", "", hostsUsage)
+	flag.StringVar(&cmdConfig.LockFile, "lock-file", "", lockFileUsage)
+	flag.DurationVar(&cmdConfig.LockWait, "lock-wait", 0, lockWaitUsage)
+	flag.Var(&cmdConfig.Overrides, "set", setUsage)
+
+	flag.Usage = usage
 	flag.Parse()
 
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "c" {
+			cmdConfig.configFileSet = true
+		}
+	})
+
 	return cmdConfig
 }
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprint(flag.CommandLine.Output(), commandsUsage)
+	fmt.Fprint(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// addrInfo returns the addresses specified on the command line or nil if
+// the addresses should be detected. With -stdin the addresses are read from
+// stdin.
+func (c *cmdConfig) addrInfo(stdin io.Reader) (*internal.AddrInfo, error) {
+	addrInfo := &internal.AddrInfo{}
+
+	if c.Stdin {
+		if err := addrInfo.Parse(stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.IPv4 != "" {
+		if err := addrInfo.SetIPv4(c.IPv4); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.IPv6 != "" {
+		if err := addrInfo.SetIPv6(c.IPv6); err != nil {
+			return nil, err
+		}
+	}
+
+	if addrInfo.Empty() {
+		if c.Stdin {
+			return nil, errNoStdinAddress
+		}
+		return nil, nil
+	}
+
+	return addrInfo, nil
+}
+
+// acquireRunLock acquires the lock that prevents concurrent runs from
+// clobbering the cache.
+func acquireRunLock(c *cmdConfig) (*internal.FileLock, error) {
+	lockFile := c.LockFile
+	if lockFile == "" {
+		var err error
+		lockFile, err = internal.DefaultRunLock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return internal.AcquireLock(lockFile, c.LockWait)
+}
+
+func splitList(list string) []string {
+	var result []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Hentra/dyndns-netcup-go/internal"
+)
+
+func TestAddrInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  cmdConfig
+		stdin   string
+		want    *internal.AddrInfo
+		wantErr bool
+	}{
+		{
+			name:   "detect",
+			config: cmdConfig{},
+		},
+		{
+			name:   "flags",
+			config: cmdConfig{IPv4: "203.0.113.1", IPv6: "remove"},
+			want:   &internal.AddrInfo{IPv4: "203.0.113.1", IPv6: internal.RemoveAddress},
+		},
+		{
+			name:    "ipv4 passed as ipv6",
+			config:  cmdConfig{IPv6: "203.0.113.1"},
+			wantErr: true,
+		},
+		{
+			name:   "mixed addresses on stdin",
+			config: cmdConfig{Stdin: true},
+			stdin:  "2001:db8::1, 203.0.113.1\n",
+			want:   &internal.AddrInfo{IPv4: "203.0.113.1", IPv6: "2001:db8::1"},
+		},
+		{
+			name:   "flags override stdin",
+			config: cmdConfig{Stdin: true, IPv4: "203.0.113.2"},
+			stdin:  "203.0.113.1 2001:db8::1",
+			want:   &internal.AddrInfo{IPv4: "203.0.113.2", IPv6: "2001:db8::1"},
+		},
+		{
+			name:    "empty stdin",
+			config:  cmdConfig{Stdin: true},
+			stdin:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.config.addrInfo(strings.NewReader(test.stdin))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("addrInfo() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+				t.Errorf("addrInfo() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"all succeeded", nil, 0},
+		{"some failed", &internal.RunError{Errors: []error{errors.New("domain example.de: loading zone")}}, exitPartialFailure},
+		{"some failed wrapped", fmt.Errorf("run: %w", &internal.RunError{}), exitPartialFailure},
+		{"none configured", errors.New("no record could be configured"), 1},
+	}
+
+	for _, test := range tests {
+		if got := exitStatus(test.err); got != test.want {
+			t.Errorf("%s: exitStatus() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -2,4 +2,10 @@ module github.com/Hentra/dyndns-netcup-go
 
 go 1.25
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/sys v0.29.0
+	golang.org/x/term v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
+)
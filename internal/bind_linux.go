@@ -0,0 +1,21 @@
+package internal
+
+import (
+	"syscall"
+)
+
+// bindToDevice returns a dialer control function that binds a socket to a
+// specified network interface.
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+
+		return bindErr
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindToDevice is only supported on linux.
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, errors.New("binding to an interface is only supported on linux")
+}
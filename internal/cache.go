@@ -1,197 +1,457 @@
 package internal
 
 import (
-	"encoding/csv"
+	"encoding/json"
 	"io"
 	"os"
+	"strings"
 	"time"
 )
 
 const (
 	defaultDir     string = "/dyndns-netcup-go"
 	defaultIPCache string = "ip.cache"
+	defaultRunLock string = "run.lock"
+
+	// cacheLockWait is the time to wait for the lock of the cache file.
+	cacheLockWait = 10 * time.Second
+
+	// maxHistory is the maximum number of history entries that are kept.
+	maxHistory = 1000
 )
 
-// Cache represents a cache for storing CacheEntries.
+// Cache represents a cache for storing CacheEntries. It keeps its State in
+// a StateStore.
 type Cache struct {
-	location string
-	timeout  time.Duration
-	changes  bool
-	entries  []CacheEntry
+	store   StateStore
+	timeout time.Duration
+	changes bool
+	state   *State
+	staged  map[string][]CacheEntry
 }
 
-// CacheEntry represents a cache entry.
+// CacheEntry represents the cached value of a single DNS record.
 type CacheEntry struct {
-	host string
-	ipv4 string
-	ipv6 string
-}
-
-// NewCache returns a new cache struct with a specified location and timeout. When
-// the location is an empty string it will set the cache location to the user cache
-// dir.
-func NewCache(location string, timeout time.Duration) (*Cache, error) {
-	if location == "" {
-		var err error
-		location, err = os.UserCacheDir()
-		if err != nil {
-			return nil, err
-		}
+	Domain       string    `json:"domain"`
+	Host         string    `json:"host"`
+	Type         string    `json:"type"`
+	Value        string    `json:"value"`
+	RecordID     string    `json:"recordId,omitempty"`
+	LastVerified time.Time `json:"lastVerified"`
+	LastChanged  time.Time `json:"lastChanged"`
+}
 
-		location += defaultDir
+// legacyEntry represents an entry of the old csv cache format. It is keyed
+// by 'host.domain' which cannot be split unambiguously, so legacy entries are
+// migrated as soon as a domain and host asks for them.
+type legacyEntry struct {
+	ipv4     string
+	ipv6     string
+	modified time.Time
+}
 
-		if _, err := os.Stat(location); os.IsNotExist(err) {
-			err = os.MkdirAll(location, 0700)
-			if err != nil {
-				return nil, err
-			}
-		}
+// NewCache returns a new cache that keeps its state in a specified store.
+// Entries that were last verified before the timeout are ignored.
+func NewCache(store StateStore, timeout time.Duration) *Cache {
+	return &Cache{
+		store:   store,
+		timeout: timeout,
+		state:   newState(),
+	}
+}
 
-		location += "/" + defaultIPCache
+// DefaultRunLock returns the default location of the lock file that
+// prevents concurrent runs.
+func DefaultRunLock() (string, error) {
+	dir, err := defaultCacheDir()
+	if err != nil {
+		return "", err
 	}
 
-	return &Cache{location, timeout, false, nil}, nil
+	return dir + "/" + defaultRunLock, nil
 }
 
-// Load loads the cache from its location. When there is no file at the
-// cache location it will do nothing. If the last modification to the file
-// was made before the cache timeout it will ignore the file content.
-func (c *Cache) Load() error {
-	csvfile, err := os.Open(c.location)
+// defaultCacheDir returns the directory for the cache inside of the user
+// cache dir. The directory is created if it does not exist.
+func defaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+		return "", err
+	}
+
+	dir += defaultDir
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return "", err
 		}
-		return err
 	}
 
-	fileinfo, err := csvfile.Stat()
+	return dir, nil
+}
+
+// Load loads the cache from its store. A store that is shared between
+// processes stays locked until Store, Release or Close is called. Legacy
+// entries are migrated to the current format on the next Store.
+func (c *Cache) Load() error {
+	state, err := c.store.Load()
 	if err != nil {
 		return err
 	}
 
-	if time.Since(fileinfo.ModTime()) > c.timeout {
+	c.state = state
+	c.changes = len(state.legacy) > 0
+	return nil
+}
+
+// Get returns the entry for a specified domain, host and record type. If
+// there is no such entry or it was last verified before the cache timeout it
+// will return nil.
+func (c *Cache) Get(domain, host, dnstype string) *CacheEntry {
+	c.migrate(domain, host)
+
+	entry := c.getEntry(domain, host, dnstype)
+	if entry == nil || time.Since(entry.LastVerified) > c.timeout {
 		return nil
 	}
 
-	r := csv.NewReader(csvfile)
+	return entry
+}
 
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+// Set sets the value of the entry for a specified domain, host and record
+// type and marks it as verified. The record id is only updated if it is not
+// empty.
+func (c *Cache) Set(domain, host, dnstype, value, recordID string) {
+	c.migrate(domain, host)
+
+	now := time.Now()
+	entry := c.getEntry(domain, host, dnstype)
+	if entry == nil {
+		c.state.Entries = append(c.state.Entries, CacheEntry{
+			Domain: domain,
+			Host:   host,
+			Type:   dnstype,
+		})
+		entry = &c.state.Entries[len(c.state.Entries)-1]
+	}
+
+	if entry.Value != value || entry.LastChanged.IsZero() {
+		entry.Value = value
+		entry.LastChanged = now
+		c.addHistory(HistoryEntry{domain, host, dnstype, value, now})
+	}
+
+	if recordID != "" {
+		entry.RecordID = recordID
+	}
+
+	entry.LastVerified = now
+	c.changes = true
+}
+
+// IsSkipped returns whether a record of a specified domain, host and type was
+// skipped with a specified value within the cache timeout.
+func (c *Cache) IsSkipped(domain, host, dnstype, value string) bool {
+	for _, skipped := range c.state.Skipped {
+		if skipped.Domain == domain && skipped.Host == host && skipped.Type == dnstype {
+			return skipped.Value == value && time.Since(skipped.LastVerified) <= c.timeout
 		}
+	}
 
-		entry := CacheEntry{
-			host: record[0],
-			ipv4: record[1],
-			ipv6: record[2],
+	return false
+}
+
+// Skip remembers that a record of a specified domain, host and type was
+// skipped with a specified value. Skipped records that expired are removed.
+func (c *Cache) Skip(domain, host, dnstype, value string) {
+	now := time.Now()
+
+	var kept []CacheEntry
+	for _, skipped := range c.state.Skipped {
+		expired := now.Sub(skipped.LastVerified) > c.timeout
+		if !expired && (skipped.Domain != domain || skipped.Host != host || skipped.Type != dnstype) {
+			kept = append(kept, skipped)
 		}
+	}
+
+	c.state.Skipped = append(kept, CacheEntry{
+		Domain:       domain,
+		Host:         host,
+		Type:         dnstype,
+		Value:        value,
+		LastVerified: now,
+	})
+	c.changes = true
+}
 
-		c.entries = append(c.entries, entry)
+// Stage stages a value for the entry of a specified domain, host and record
+// type. Staged values are not visible until they are committed with Commit.
+// This way the cache only contains values that were accepted by netcup.
+func (c *Cache) Stage(domain, host, dnstype, value, recordID string) {
+	if c.staged == nil {
+		c.staged = make(map[string][]CacheEntry)
 	}
 
-	return csvfile.Close()
+	c.staged[domain] = append(c.staged[domain], CacheEntry{
+		Domain:   domain,
+		Host:     host,
+		Type:     dnstype,
+		Value:    value,
+		RecordID: recordID,
+	})
 }
 
-// SetIPv4 sets the ipv4 address for a specified domain and host to
-// a specified ipv4 address.
-func (c *Cache) SetIPv4(domain, host, ipv4 string) {
-	entry := c.getEntry(domain, host)
-	if entry == nil {
-		newEntry := CacheEntry{
-			host: host + "." + domain,
-			ipv4: ipv4,
-			ipv6: "",
+// Commit sets all staged values of a specified domain.
+func (c *Cache) Commit(domain string) {
+	for _, entry := range c.staged[domain] {
+		c.Set(entry.Domain, entry.Host, entry.Type, entry.Value, entry.RecordID)
+	}
+
+	delete(c.staged, domain)
+}
+
+// Discard drops all staged values of a specified domain.
+func (c *Cache) Discard(domain string) {
+	delete(c.staged, domain)
+}
+
+// Entries returns all entries of the cache.
+func (c *Cache) Entries() []CacheEntry {
+	return c.state.Entries
+}
+
+// Clear removes the entries of a specified host. The host is either the
+// name of a host like in the config or its fully qualified name. If the host
+// is an empty string all entries and zone snapshots are removed. It returns
+// the number of removed entries.
+func (c *Cache) Clear(host string) int {
+	var kept []CacheEntry
+	for _, entry := range c.state.Entries {
+		if host == "" || entry.matches(host) {
+			continue
 		}
+		kept = append(kept, entry)
+	}
+
+	removed := len(c.state.Entries) - len(kept)
+	c.state.Entries = kept
+
+	var skipped []CacheEntry
+	for _, entry := range c.state.Skipped {
+		if host != "" && !entry.matches(host) {
+			skipped = append(skipped, entry)
+		}
+	}
+	c.state.Skipped = skipped
 
-		c.entries = append(c.entries, newEntry)
-	} else {
-		entry.ipv4 = ipv4
+	if host == "" {
+		c.state.Zones = make(map[string]ZoneSnapshot)
 	}
 
 	c.changes = true
+	return removed
 }
 
-// SetIPv6 sets the ipv6 address for a specified domain and host to
-// a specified ipv6 address.
-func (c *Cache) SetIPv6(domain, host, ipv6 string) {
-	entry := c.getEntry(domain, host)
-	if entry == nil {
-		newEntry := CacheEntry{
-			host: host + "." + domain,
-			ipv4: "",
-			ipv6: ipv6,
+// Export writes the whole state of the cache as JSON to a specified writer.
+func (c *Cache) Export(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(fileState{
+		Version: stateVersion,
+		State:   c.state,
+	})
+}
+
+// History returns the changes of the record values, oldest first.
+func (c *Cache) History() []HistoryEntry {
+	return c.state.History
+}
+
+// Zone returns the last snapshot of the zone of a specified domain or nil if
+// there is none.
+func (c *Cache) Zone(domain string) *ZoneSnapshot {
+	snapshot, ok := c.state.Zones[domain]
+	if !ok {
+		return nil
+	}
+
+	return &snapshot
+}
+
+// SetZone sets the snapshot of the zone of a specified domain.
+func (c *Cache) SetZone(domain string, snapshot ZoneSnapshot) {
+	c.state.Zones[domain] = snapshot
+	c.changes = true
+}
+
+// DeleteZone removes the snapshot of the zone of a specified domain.
+func (c *Cache) DeleteZone(domain string) {
+	if _, ok := c.state.Zones[domain]; ok {
+		delete(c.state.Zones, domain)
+		c.changes = true
+	}
+}
+
+// LastRun returns the result of the last run or nil if there is none.
+func (c *Cache) LastRun() *RunResult {
+	return c.state.LastRun
+}
+
+// SetLastRun sets the result of the last run.
+func (c *Cache) SetLastRun(result RunResult) {
+	c.state.LastRun = &result
+	c.changes = true
+}
+
+// CheckFingerprint compares a specified fingerprint with the one stored for
+// a domain. If they differ, all entries, skipped records and the zone
+// snapshot of the domain are removed and the new fingerprint is stored. It
+// returns false in that case. If no fingerprint is stored yet, e.g. because
+// the cache was written by an older version, the fingerprint is stored and
+// the entries are kept, so legacy entries can still be migrated.
+func (c *Cache) CheckFingerprint(domain, fingerprint string) bool {
+	stored, ok := c.state.Fingerprints[domain]
+	if stored == fingerprint {
+		return true
+	}
+
+	if !ok || stored == "" {
+		c.state.Fingerprints[domain] = fingerprint
+		c.changes = true
+		return true
+	}
+
+	var kept []CacheEntry
+	for _, entry := range c.state.Entries {
+		if entry.Domain != domain {
+			kept = append(kept, entry)
 		}
+	}
 
-		c.entries = append(c.entries, newEntry)
-	} else {
-		entry.ipv6 = ipv6
+	c.state.Entries = kept
+	delete(c.state.Zones, domain)
+	c.state.Fingerprints[domain] = fingerprint
+
+	var skipped []CacheEntry
+	for _, entry := range c.state.Skipped {
+		if entry.Domain != domain {
+			skipped = append(skipped, entry)
+		}
 	}
+	c.state.Skipped = skipped
 
+	for key := range c.state.legacy {
+		if strings.HasSuffix(key, "."+domain) {
+			delete(c.state.legacy, key)
+		}
+	}
 	c.changes = true
+
+	return false
 }
 
-// GetIPv4 returns the ipv4 address of a specified domain and host. If
-// this ipv4 address is not present in the cache it will return an empty string.
-func (c *Cache) GetIPv4(domain, host string) string {
-	entry := c.getEntry(domain, host)
-	if entry == nil {
-		return ""
+// VerificationDue counts a run and returns true if the cache should be
+// bypassed in this run. This is the case when at least a specified number of
+// runs happened or a specified interval passed since the last verification.
+// Zero disables the respective condition.
+func (c *Cache) VerificationDue(runs int, interval time.Duration) bool {
+	c.state.Runs++
+	c.changes = true
+
+	if runs > 0 && c.state.Runs >= runs {
+		return true
 	}
 
-	return entry.ipv4
+	return interval > 0 && time.Since(c.state.LastVerification) >= interval
 }
 
-// GetIPv6 returns the ipv6 address of a specified domain and host. If
-// this ipv6 address is not present in the cache it will return an empty string.
-func (c *Cache) GetIPv6(domain, host string) string {
-	entry := c.getEntry(domain, host)
-	if entry == nil {
-		return ""
+// Verified marks the current run as verification.
+func (c *Cache) Verified() {
+	c.state.Runs = 0
+	c.state.LastVerification = time.Now()
+	c.changes = true
+}
+
+func (c *Cache) addHistory(entry HistoryEntry) {
+	c.state.History = append(c.state.History, entry)
+	if len(c.state.History) > maxHistory {
+		c.state.History = c.state.History[len(c.state.History)-maxHistory:]
+	}
+}
+
+// FQDN returns the fully qualified name of the host of the entry.
+func (e *CacheEntry) FQDN() string {
+	if e.Host == "@" {
+		return e.Domain
 	}
 
-	return entry.ipv6
+	return e.Host + "." + e.Domain
 }
 
-func (c *Cache) getEntry(domain, host string) *CacheEntry {
-	for i, entry := range c.entries {
-		if entry.host == (host + "." + domain) {
-			return &c.entries[i]
+func (e *CacheEntry) matches(host string) bool {
+	return e.Host == host || e.FQDN() == host || e.Host+"."+e.Domain == host
+}
+
+func (c *Cache) getEntry(domain, host, dnstype string) *CacheEntry {
+	for i, entry := range c.state.Entries {
+		if entry.Domain == domain && entry.Host == host && entry.Type == dnstype {
+			return &c.state.Entries[i]
 		}
 	}
 
 	return nil
 }
 
-// Store stores the cache to its location on the disk. If the
-// cache location does not exist it will create the necessary file.
+// migrate converts the legacy entry of a specified domain and host to
+// entries of the current format.
+func (c *Cache) migrate(domain, host string) {
+	legacy, ok := c.state.legacy[host+"."+domain]
+	if !ok {
+		return
+	}
+	delete(c.state.legacy, host+"."+domain)
+
+	for _, record := range [][2]string{{"A", legacy.ipv4}, {"AAAA", legacy.ipv6}} {
+		dnstype, value := record[0], record[1]
+		if value == "" || c.getEntry(domain, host, dnstype) != nil {
+			continue
+		}
+
+		c.state.Entries = append(c.state.Entries, CacheEntry{
+			Domain:       domain,
+			Host:         host,
+			Type:         dnstype,
+			Value:        value,
+			LastVerified: legacy.modified,
+			LastChanged:  legacy.modified,
+		})
+	}
+}
+
+// Store stores the cache in its store if anything changed. Either way the
+// lock that Load acquired is released.
 func (c *Cache) Store() error {
 	if !c.changes {
-		return nil
+		return c.store.Unlock()
 	}
 
-	csvfile, err := os.Create(c.location)
+	err := c.store.Save(c.state)
 	if err != nil {
 		return err
 	}
 
-	writer := csv.NewWriter(csvfile)
-	defer writer.Flush()
-
-	for _, entry := range c.entries {
-		err = writer.Write(entry.toArray())
-		if err != nil {
-			return err
-		}
-	}
-
+	c.changes = false
 	return nil
 }
 
-func (e *CacheEntry) toArray() []string {
-	return []string{e.host, e.ipv4, e.ipv6}
+// Release releases the lock that Load acquired without storing the cache.
+func (c *Cache) Release() error {
+	return c.store.Unlock()
+}
+
+// Close closes the store of the cache.
+func (c *Cache) Close() error {
+	return c.store.Close()
 }
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyCacheMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		domain string
+		host   string
+		// want maps the record types to the expected values. A missing type
+		// must not have an entry.
+		want map[string]string
+	}{
+		{
+			name:   "both families",
+			csv:    "www.example.de,203.0.113.1,2001:db8::1\n",
+			domain: "example.de",
+			host:   "www",
+			want:   map[string]string{"A": "203.0.113.1", "AAAA": "2001:db8::1"},
+		},
+		{
+			name:   "ipv4 only",
+			csv:    "@.example.de,203.0.113.2,\n",
+			domain: "example.de",
+			host:   "@",
+			want:   map[string]string{"A": "203.0.113.2"},
+		},
+		{
+			name:   "subdomain of another domain",
+			csv:    "a.b.example.com,203.0.113.3,\nwww.example.de,203.0.113.4,\n",
+			domain: "b.example.com",
+			host:   "a",
+			want:   map[string]string{"A": "203.0.113.3"},
+		},
+		{
+			name:   "malformed lines are ignored",
+			csv:    "broken\nwww.example.de,203.0.113.5,\n",
+			domain: "example.de",
+			host:   "www",
+			want:   map[string]string{"A": "203.0.113.5"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location := filepath.Join(t.TempDir(), "ip.cache")
+			if err := os.WriteFile(location, []byte(test.csv), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cache := loadTestCache(t, location)
+
+			// Caches of older versions have no fingerprints. That must not
+			// invalidate the legacy entries before they are migrated.
+			if !cache.CheckFingerprint(test.domain, "fingerprint") {
+				t.Error("CheckFingerprint() = false for a cache without fingerprints")
+			}
+
+			assertEntries(t, cache, test.domain, test.host, test.want)
+
+			if err := cache.Store(); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(content), "{") {
+				t.Errorf("cache was not converted to JSON: %s", content)
+			}
+
+			cache = loadTestCache(t, location)
+			assertEntries(t, cache, test.domain, test.host, test.want)
+
+			if !cache.CheckFingerprint(test.domain, "fingerprint") {
+				t.Error("CheckFingerprint() = false for the stored fingerprint")
+			}
+
+			if cache.CheckFingerprint(test.domain, "changed") {
+				t.Error("CheckFingerprint() = true for a changed fingerprint")
+			}
+			assertEntries(t, cache, test.domain, test.host, nil)
+		})
+	}
+}
+
+func TestCacheSkip(t *testing.T) {
+	cache := NewCache(NewMemoryStateStore(), time.Hour)
+
+	cache.Skip("example.de", "www", "A", "203.0.113.1")
+
+	tests := []struct {
+		host, dnstype, value string
+		want                 bool
+	}{
+		{"www", "A", "203.0.113.1", true},
+		{"www", "A", "203.0.113.2", false},
+		{"www", "AAAA", "203.0.113.1", false},
+		{"@", "A", "203.0.113.1", false},
+	}
+
+	for _, test := range tests {
+		if got := cache.IsSkipped("example.de", test.host, test.dnstype, test.value); got != test.want {
+			t.Errorf("IsSkipped(%s, %s, %s) = %v, want %v", test.host, test.dnstype, test.value, got, test.want)
+		}
+	}
+
+	cache.CheckFingerprint("example.de", "a")
+	cache.CheckFingerprint("example.de", "b")
+	if cache.IsSkipped("example.de", "www", "A", "203.0.113.1") {
+		t.Error("skipped record was kept after the config changed")
+	}
+}
+
+func loadTestCache(t *testing.T, location string) *Cache {
+	t.Helper()
+
+	cache := NewCache(NewFileStateStore(location), time.Hour)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+
+	return cache
+}
+
+func assertEntries(t *testing.T, cache *Cache, domain, host string, want map[string]string) {
+	t.Helper()
+
+	for _, dnstype := range []string{"A", "AAAA"} {
+		entry := cache.Get(domain, host, dnstype)
+		value, ok := want[dnstype]
+		switch {
+		case !ok && entry != nil:
+			t.Errorf("%s record of %s.%s: unexpected entry %q", dnstype, host, domain, entry.Value)
+		case ok && entry == nil:
+			t.Errorf("%s record of %s.%s: no entry, want %q", dnstype, host, domain, value)
+		case ok && entry.Value != value:
+			t.Errorf("%s record of %s.%s = %q, want %q", dnstype, host, domain, entry.Value, value)
+		}
+	}
+}
+
+func TestCacheStage(t *testing.T) {
+	cache := NewCache(NewMemoryStateStore(), time.Hour)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("example.de", "www", "A", "192.0.2.1", "1")
+
+	cache.Stage("example.de", "www", "A", "203.0.113.1", "1")
+	cache.Stage("example.de", "@", "A", "203.0.113.1", "")
+	cache.Stage("example.com", "www", "A", "203.0.113.2", "")
+
+	// Staged values are invisible until netcup accepted them.
+	assertEntries(t, cache, "example.de", "www", map[string]string{"A": "192.0.2.1"})
+	assertEntries(t, cache, "example.de", "@", nil)
+
+	cache.Discard("example.de")
+	cache.Commit("example.de")
+	assertEntries(t, cache, "example.de", "www", map[string]string{"A": "192.0.2.1"})
+	assertEntries(t, cache, "example.de", "@", nil)
+
+	cache.Commit("example.com")
+	assertEntries(t, cache, "example.com", "www", map[string]string{"A": "203.0.113.2"})
+
+	cache.Stage("example.de", "www", "A", "203.0.113.1", "1")
+	cache.Commit("example.de")
+	assertEntries(t, cache, "example.de", "www", map[string]string{"A": "203.0.113.1"})
+}
+
+func TestVerificationDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		runs     int
+		interval time.Duration
+		// previousRuns is the number of runs since the last verification and
+		// verifiedAgo the time since it.
+		previousRuns int
+		verifiedAgo  time.Duration
+		want         bool
+	}{
+		{name: "disabled", previousRuns: 100, verifiedAgo: 100 * time.Hour},
+		{name: "runs not reached", runs: 3, previousRuns: 1},
+		{name: "runs reached", runs: 3, previousRuns: 2, want: true},
+		{name: "interval not passed", interval: time.Hour, verifiedAgo: 30 * time.Minute},
+		{name: "interval passed", interval: time.Hour, verifiedAgo: 2 * time.Hour, want: true},
+		{name: "either condition", runs: 10, interval: time.Hour, previousRuns: 1, verifiedAgo: 2 * time.Hour, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewCache(NewMemoryStateStore(), time.Hour)
+			if err := cache.Load(); err != nil {
+				t.Fatal(err)
+			}
+			cache.state.Runs = test.previousRuns
+			cache.state.LastVerification = time.Now().Add(-test.verifiedAgo)
+
+			if got := cache.VerificationDue(test.runs, test.interval); got != test.want {
+				t.Errorf("VerificationDue() = %v, want %v", got, test.want)
+			}
+			if cache.state.Runs != test.previousRuns+1 {
+				t.Errorf("runs = %d, want %d", cache.state.Runs, test.previousRuns+1)
+			}
+		})
+	}
+}
+
+func TestVerifiedResetsConditions(t *testing.T) {
+	cache := NewCache(NewMemoryStateStore(), time.Hour)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cache.VerificationDue(1, time.Hour) {
+		t.Fatal("verification of a new cache is not due")
+	}
+	cache.Verified()
+
+	if cache.state.Runs != 0 || time.Since(cache.state.LastVerification) > time.Minute {
+		t.Errorf("Verified() left runs %d and last verification %v", cache.state.Runs, cache.state.LastVerification)
+	}
+	if cache.VerificationDue(2, time.Hour) {
+		t.Error("verification is due right after a verification")
+	}
+	if !cache.VerificationDue(2, time.Hour) {
+		t.Error("verification is not due after 2 runs")
+	}
+}
+
+func TestCheckFingerprint(t *testing.T) {
+	cache := NewCache(NewMemoryStateStore(), time.Hour)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, domain := range []string{"example.de", "example.com"} {
+		cache.Set(domain, "www", "A", "203.0.113.1", "")
+		cache.Skip(domain, "@", "A", "203.0.113.1")
+		cache.SetZone(domain, ZoneSnapshot{Serial: "1"})
+	}
+
+	// Entries without a stored fingerprint are kept.
+	if !cache.CheckFingerprint("example.de", "a") || !cache.CheckFingerprint("example.com", "a") {
+		t.Fatal("CheckFingerprint() = false without a stored fingerprint")
+	}
+	assertEntries(t, cache, "example.de", "www", map[string]string{"A": "203.0.113.1"})
+
+	if !cache.CheckFingerprint("example.de", "a") {
+		t.Error("CheckFingerprint() = false for an unchanged fingerprint")
+	}
+	assertEntries(t, cache, "example.de", "www", map[string]string{"A": "203.0.113.1"})
+
+	if cache.CheckFingerprint("example.de", "b") {
+		t.Error("CheckFingerprint() = true for a changed fingerprint")
+	}
+	assertEntries(t, cache, "example.de", "www", nil)
+	if cache.IsSkipped("example.de", "@", "A", "203.0.113.1") || cache.Zone("example.de") != nil {
+		t.Error("skipped records or zone snapshot of a changed domain were kept")
+	}
+
+	// Other domains are not affected.
+	assertEntries(t, cache, "example.com", "www", map[string]string{"A": "203.0.113.1"})
+	if !cache.IsSkipped("example.com", "@", "A", "203.0.113.1") || cache.Zone("example.com") == nil {
+		t.Error("skipped records or zone snapshot of an unchanged domain were removed")
+	}
+
+	if !cache.CheckFingerprint("example.de", "b") {
+		t.Error("CheckFingerprint() = false for the new fingerprint")
+	}
+}
@@ -1,74 +1,468 @@
 package internal
 
 import (
-	"io/ioutil"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 
-	"gopkg.in/yaml.v2"
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultAccount is the name of the account that domains without an
+// account belong to.
+const DefaultAccount = "default"
+
 // Config represents a config.
 type Config struct {
-	CustomerNumber int      `yaml:"CUSTOMERNR"`
-	APIKey         string   `yaml:"APIKEY"`
-	APIPassword    string   `yaml:"APIPASSWORD"`
-	IPCache        string   `yaml:"IP-CACHE"`
-	IPCacheTimeout int      `yaml:"IP-CACHE-TIMEOUT"`
-	Domains        []Domain `yaml:"DOMAINS"`
+	CustomerNumber  int                       `yaml:"CUSTOMERNR"`
+	APIKey          Secret                    `yaml:"APIKEY"`
+	APIKeyFile      string                    `yaml:"APIKEY-FILE"`
+	APIPassword     Secret                    `yaml:"APIPASSWORD"`
+	APIPasswordFile string                    `yaml:"APIPASSWORD-FILE"`
+	IPCache         string                    `yaml:"IP-CACHE"`
+	IPCacheTimeout  int                       `yaml:"IP-CACHE-TIMEOUT"`
+	IPCacheBackend  string                    `yaml:"IP-CACHE-BACKEND"`
+	VerifyRuns      int                       `yaml:"VERIFY-EVERY-RUNS"`
+	VerifyInterval  int                       `yaml:"VERIFY-INTERVAL"`
+	Accounts        map[string]Account        `yaml:"ACCOUNTS"`
+	IPSources       map[string]IPSourceConfig `yaml:"IP-SOURCES"`
+	Defaults        Defaults                  `yaml:"DEFAULTS,omitempty"`
+	Domains         []Domain                  `yaml:"DOMAINS"`
+	Include         []string                  `yaml:"INCLUDE,omitempty"`
+
+	fingerprints map[string]string
+	// includes contains the resolved INCLUDE patterns of all config files and
+	// fragments the files that were included.
+	includes  []string
+	fragments []string
+	// positions contains where every key was set and problems the unknown
+	// keys and type errors found while loading.
+	positions map[string]string
+	problems  []Problem
 }
 
-// Domain represents a domain.
+// Account represents the credentials of a netcup account.
+type Account struct {
+	CustomerNumber  int    `yaml:"CUSTOMERNR"`
+	APIKey          Secret `yaml:"APIKEY"`
+	APIKeyFile      string `yaml:"APIKEY-FILE"`
+	APIPassword     Secret `yaml:"APIPASSWORD"`
+	APIPasswordFile string `yaml:"APIPASSWORD-FILE"`
+}
+
+// NewClient returns a netcup client for the account.
+func (a Account) NewClient() *netcup.Client {
+	return netcup.NewClient(a.CustomerNumber, string(a.APIKey), string(a.APIPassword))
+}
+
+// IPSourceConfig represents the configuration of a named ip source. Headers
+// that carry credentials are redacted when the config is printed.
+type IPSourceConfig struct {
+	Type       string            `yaml:"TYPE,omitempty"`
+	IPv4       string            `yaml:"IPV4,omitempty"`
+	IPv6       string            `yaml:"IPV6,omitempty"`
+	Command    string            `yaml:"COMMAND,omitempty"`
+	Args       []string          `yaml:"ARGS,omitempty"`
+	Env        map[string]string `yaml:"ENV,omitempty"`
+	Timeout    int               `yaml:"TIMEOUT,omitempty"`
+	Regex      string            `yaml:"REGEX,omitempty"`
+	URL        string            `yaml:"URL,omitempty"`
+	IPv4URL    string            `yaml:"IPV4-URL,omitempty"`
+	IPv6URL    string            `yaml:"IPV6-URL,omitempty"`
+	Method     string            `yaml:"METHOD,omitempty"`
+	Headers    Headers           `yaml:"HEADERS,omitempty"`
+	Extract    string            `yaml:"EXTRACT,omitempty"`
+	JSONPath   string            `yaml:"JSON-PATH,omitempty"`
+	Header     string            `yaml:"HEADER,omitempty"`
+	Interface  string            `yaml:"INTERFACE,omitempty"`
+	SourceIPv4 string            `yaml:"SOURCE-IPV4,omitempty"`
+	SourceIPv6 string            `yaml:"SOURCE-IPV6,omitempty"`
+	Provider   string            `yaml:"PROVIDER,omitempty"`
+	Endpoint   string            `yaml:"ENDPOINT,omitempty"`
+}
+
+// Defaults represents the settings every domain inherits unless it
+// specifies them itself. Settings that are not set are not inherited.
+type Defaults struct {
+	Account     string `yaml:"ACCOUNT,omitempty"`
+	IPv6        *bool  `yaml:"IPV6,omitempty"`
+	IPv4        *bool  `yaml:"IPV4,omitempty"`
+	TTL         int    `yaml:"TTL,omitempty"`
+	Refresh     int    `yaml:"REFRESH,omitempty"`
+	Retry       int    `yaml:"RETRY,omitempty"`
+	Expire      int    `yaml:"EXPIRE,omitempty"`
+	IPSource    string `yaml:"IP-SOURCE,omitempty"`
+	SkipMissing *bool  `yaml:"SKIP-MISSING,omitempty"`
+}
+
+// Domain represents a domain. The SOA timers Refresh, Retry and Expire of
+// the zone are left unchanged if they are 0. If SkipMissing is set, records
+// that do not exist are not created.
 type Domain struct {
-	Name  string   `yaml:"NAME"`
-	IPv6  bool     `yaml:"IPV6"`
-	IPv4  bool     `yaml:"IPV4"`
-	TTL   int      `yaml:"TTL"`
-	Hosts []string `yaml:"HOSTS"`
+	Name          string            `yaml:"NAME"`
+	Account       string            `yaml:"ACCOUNT"`
+	IPv6          bool              `yaml:"IPV6"`
+	IPv4          bool              `yaml:"IPV4"`
+	TTL           int               `yaml:"TTL"`
+	Refresh       int               `yaml:"REFRESH,omitempty"`
+	Retry         int               `yaml:"RETRY,omitempty"`
+	Expire        int               `yaml:"EXPIRE,omitempty"`
+	IPSource      string            `yaml:"IP-SOURCE"`
+	SkipMissing   bool              `yaml:"SKIP-MISSING,omitempty"`
+	HostIPSources map[string]string `yaml:"HOST-IP-SOURCES"`
+	Hosts         []Host            `yaml:"HOSTS"`
+
+	// set contains the keys the domain specifies itself.
+	set map[string]bool
+	// typeErr contains the type errors of the domain and its hosts until
+	// they are collected by the loader.
+	typeErr *yaml.TypeError
+}
+
+// Host represents a host of a domain. The families and the ip source of the
+// domain apply to the host unless they are overridden.
+type Host struct {
+	Name        string `yaml:"NAME"`
+	IPv4        *bool  `yaml:"IPV4,omitempty"`
+	IPv6        *bool  `yaml:"IPV6,omitempty"`
+	IPSource    string `yaml:"IP-SOURCE,omitempty"`
+	Enabled     *bool  `yaml:"ENABLED,omitempty"`
+	Description string `yaml:"DESCRIPTION,omitempty"`
+
+	typeErr *yaml.TypeError
 }
 
-// LoadConfig returns a config loaded from a specified location. It will
+// LoadConfig returns a config loaded from a specified location only. It will
 // return an error if there is no file in the specified location or it is
-// unable to read it.
+// unable to read it. Use a ConfigLoader to load all config layers.
 func LoadConfig(filename string) (*Config, error) {
-	yamlFile, err := ioutil.ReadFile(filename)
-	if err != nil {
+	config := defaultConfig()
+	if err := loadConfigFile(config, filename, false); err != nil {
 		return nil, err
 	}
+	config.applyDefaults()
 
-	var config Config
-	err = yaml.Unmarshal(yamlFile, &config)
-	if err != nil {
+	if err := config.resolveSecrets(DefaultSecretDirs()); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // UnmarshalYAML is implemented to override the default value of
-// the IPv4 field of a Domain with true.
-func (d *Domain) UnmarshalYAML(unmarshal func(interface{}) error) error {
+// the IPv4 field of a Domain with true and to record the keys that are set,
+// so the others can be inherited from the Defaults.
+func (d *Domain) UnmarshalYAML(value *yaml.Node) error {
 	type rawDomain Domain
 	raw := rawDomain{
 		IPv4: true,
 	}
-	if err := unmarshal(&raw); err != nil {
+	typeErr, err := decodePartially(value, &raw)
+	if err != nil {
 		return err
 	}
 
 	*d = Domain(raw)
+	d.typeErr = typeErr
+	for i := range d.Hosts {
+		d.typeErr = joinTypeErrors(d.typeErr, d.Hosts[i].typeErr)
+		d.Hosts[i].typeErr = nil
+	}
+
+	d.set = make(map[string]bool)
+	for _, key := range mappingKeys(value) {
+		d.set[key] = true
+	}
+
 	return nil
 }
 
+// UnmarshalYAML is implemented to accept a plain string as the name of a
+// host without any settings.
+func (h *Host) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = Host{Name: value.Value}
+		return nil
+	}
+
+	type rawHost Host
+	var raw rawHost
+	typeErr, err := decodePartially(value, &raw)
+	if err != nil {
+		return err
+	}
+
+	*h = Host(raw)
+	h.typeErr = typeErr
+	return nil
+}
+
+// decodePartially decodes a node like Decode but returns type errors
+// separately. The YAML decoder drops items of a sequence whose
+// UnmarshalYAML fails, so returning them would hide the other problems of
+// the item.
+func decodePartially(value *yaml.Node, out interface{}) (*yaml.TypeError, error) {
+	var typeErr *yaml.TypeError
+	err := value.Decode(out)
+	if errors.As(err, &typeErr) {
+		return typeErr, nil
+	}
+
+	return nil, err
+}
+
+func joinTypeErrors(a, b *yaml.TypeError) *yaml.TypeError {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	return &yaml.TypeError{Errors: append(append([]string(nil), a.Errors...), b.Errors...)}
+}
+
+// takeTypeErrors removes the type errors that were kept by the domains and
+// returns them.
+func (c *Config) takeTypeErrors() *yaml.TypeError {
+	var typeErr *yaml.TypeError
+	for i := range c.Domains {
+		typeErr = joinTypeErrors(typeErr, c.Domains[i].typeErr)
+		c.Domains[i].typeErr = nil
+	}
+
+	return typeErr
+}
+
+// MarshalYAML is implemented to encode a host without any settings as plain
+// string.
+func (h Host) MarshalYAML() (interface{}, error) {
+	if h == (Host{Name: h.Name}) {
+		return h.Name, nil
+	}
+
+	type rawHost Host
+	return rawHost(h), nil
+}
+
+// IsEnabled returns whether the records of the host should be configured.
+func (h Host) IsEnabled() bool {
+	return h.Enabled == nil || *h.Enabled
+}
+
+// EnabledHosts returns the hosts of the domain that are enabled.
+func (d *Domain) EnabledHosts() []Host {
+	var hosts []Host
+	for _, host := range d.Hosts {
+		if host.IsEnabled() {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// HostNames returns the names of all hosts of the domain.
+func (d *Domain) HostNames() []string {
+	names := make([]string, len(d.Hosts))
+	for i, host := range d.Hosts {
+		names[i] = host.Name
+	}
+
+	return names
+}
+
+// HostIPv4 returns whether the A record of a host should be configured.
+func (d *Domain) HostIPv4(host Host) bool {
+	if host.IPv4 != nil {
+		return *host.IPv4
+	}
+
+	return d.IPv4
+}
+
+// HostIPv6 returns whether the AAAA record of a host should be configured.
+func (d *Domain) HostIPv6(host Host) bool {
+	if host.IPv6 != nil {
+		return *host.IPv6
+	}
+
+	return d.IPv6
+}
+
+// AccountName returns the name of the account the domain belongs to.
+func (d *Domain) AccountName() string {
+	if d.Account == "" {
+		return DefaultAccount
+	}
+
+	return d.Account
+}
+
+// HostIPSource returns the name of the ip source for a specified host of
+// the domain.
+func (d *Domain) HostIPSource(host Host) string {
+	if host.IPSource != "" {
+		return host.IPSource
+	}
+
+	if source, ok := d.HostIPSources[host.Name]; ok {
+		return source
+	}
+
+	if d.IPSource != "" {
+		return d.IPSource
+	}
+
+	return DefaultIPSource
+}
+
+// Account returns the account with a specified name. The default account
+// is specified by the top level credentials unless it is configured in the
+// accounts.
+func (c *Config) Account(name string) (Account, bool) {
+	if account, ok := c.Accounts[name]; ok {
+		return account, true
+	}
+
+	if name != DefaultAccount {
+		return Account{}, false
+	}
+
+	return Account{
+		CustomerNumber: c.CustomerNumber,
+		APIKey:         c.APIKey,
+		APIPassword:    c.APIPassword,
+	}, true
+}
+
+// AccountNames returns the names of the accounts the configured domains
+// belong to in the order of their first domain.
+func (c *Config) AccountNames() []string {
+	var names []string
+	for _, domain := range c.Domains {
+		if !Contains(names, domain.AccountName()) {
+			names = append(names, domain.AccountName())
+		}
+	}
+
+	return names
+}
+
+// Fingerprint returns a hash of the effective configuration of a domain
+// including the ip sources it references. It changes whenever the
+// configuration of the domain changes. After Select the fingerprint of the
+// domain as configured is returned, not the one of the selection.
+func (c *Config) Fingerprint(domain Domain) (string, error) {
+	if fingerprint, ok := c.fingerprints[domain.Name]; ok {
+		return fingerprint, nil
+	}
+
+	hosts := append([]Host(nil), domain.Hosts...)
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	domain.Hosts = hosts
+
+	// The headers are revealed, so changing a credential changes the
+	// fingerprint as well.
+	type revealedSource struct {
+		IPSourceConfig
+		Headers map[string]string
+	}
+
+	sources := make(map[string]revealedSource)
+	for _, host := range domain.Hosts {
+		name := domain.HostIPSource(host)
+		sources[name] = revealedSource{c.IPSources[name], c.IPSources[name].Headers}
+	}
+
+	content, err := json.Marshal(struct {
+		Domain  Domain
+		Sources map[string]revealedSource
+	}{domain, sources})
+	if err != nil {
+		return "", fmt.Errorf("fingerprint of domain %s: %w", domain.Name, err)
+	}
+
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
+}
+
 // CacheEnabled returns whether the cache is enabled in the
 // configuration.
 func (c *Config) CacheEnabled() bool {
 	return c.IPCacheTimeout > 0
 }
 
-// IPv6Enabled returns true if at least one domain needs the AAAA
-// record configured.
-func (c *Config) IPv6Enabled() bool {
+// VerifyEnabled returns whether the cache should be bypassed periodically
+// to detect changes of the records at netcup.
+func (c *Config) VerifyEnabled() bool {
+	return c.VerifyRuns > 0 || c.VerifyInterval > 0
+}
+
+// Select restricts the configured domains and hosts to the specified ones.
+// An empty list of domains or hosts selects all of them. It returns an error
+// if a specified domain or host is not configured.
+func (c *Config) Select(domains, hosts []string) error {
+	c.fingerprints = make(map[string]string)
+	for _, domain := range c.Domains {
+		fingerprint, err := c.Fingerprint(domain)
+		if err != nil {
+			return err
+		}
+		c.fingerprints[domain.Name] = fingerprint
+	}
+
+	var selected []Domain
 	for _, domain := range c.Domains {
-		if domain.IPv6 {
+		if len(domains) > 0 && !Contains(domains, domain.Name) {
+			continue
+		}
+
+		if len(hosts) > 0 {
+			var selectedHosts []Host
+			for _, host := range domain.Hosts {
+				if Contains(hosts, host.Name) {
+					selectedHosts = append(selectedHosts, host)
+				}
+			}
+
+			if len(selectedHosts) == 0 {
+				continue
+			}
+			domain.Hosts = selectedHosts
+		}
+
+		selected = append(selected, domain)
+	}
+
+	for _, name := range domains {
+		if !containsDomain(c.Domains, name) {
+			return fmt.Errorf("domain '%s' is not configured", name)
+		}
+	}
+
+	for _, host := range hosts {
+		if !containsHost(selected, host) {
+			return fmt.Errorf("host '%s' is not configured for the selected domains", host)
+		}
+	}
+
+	c.Domains = selected
+	return nil
+}
+
+// Contains returns true if a list of strings contains a specified value.
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
 			return true
 		}
 	}
@@ -76,11 +470,19 @@ func (c *Config) IPv6Enabled() bool {
 	return false
 }
 
-// IPv4Enabled returns true if at least one domain needs the A
-// record configured.
-func (c *Config) IPv4Enabled() bool {
-	for _, domain := range c.Domains {
-		if domain.IPv4 {
+func containsDomain(domains []Domain, name string) bool {
+	for _, domain := range domains {
+		if domain.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsHost(domains []Domain, host string) bool {
+	for _, domain := range domains {
+		if Contains(domain.HostNames(), host) {
 			return true
 		}
 	}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyDefaults sets every setting of the Defaults on the domains that do
+// not specify it themselves.
+func (c *Config) applyDefaults() {
+	defaults := reflect.ValueOf(c.Defaults)
+
+	for i := range c.Domains {
+		inherited := c.inherited(c.Domains[i])
+		domain := reflect.ValueOf(&c.Domains[i]).Elem()
+
+		for j := 0; j < defaults.NumField(); j++ {
+			key := yamlKey(defaults.Type().Field(j))
+			field, ok := structFieldByExactKey(domain.Type(), key)
+			if !inherited[key] || !ok {
+				continue
+			}
+
+			value := defaults.Field(j)
+			if value.Kind() == reflect.Ptr {
+				value = value.Elem()
+			}
+			domain.FieldByIndex(field.Index).Set(value)
+		}
+	}
+}
+
+// inherited returns the keys of the settings a domain inherits from the
+// Defaults.
+func (c *Config) inherited(domain Domain) map[string]bool {
+	inherited := make(map[string]bool)
+	defaults := reflect.ValueOf(c.Defaults)
+	for i := 0; i < defaults.NumField(); i++ {
+		key := yamlKey(defaults.Type().Field(i))
+		if !defaults.Field(i).IsZero() && !domain.set[key] {
+			inherited[key] = true
+		}
+	}
+
+	return inherited
+}
+
+// Effective returns a copy of the config in which every domain and host
+// specifies all of its settings. The defaults are applied, the account and
+// ip source names are resolved and the host settings are inherited from the
+// domains.
+func (c *Config) Effective() *Config {
+	effective := *c
+	effective.Defaults = Defaults{}
+	effective.Domains = make([]Domain, len(c.Domains))
+
+	for i, domain := range c.Domains {
+		hosts := make([]Host, len(domain.Hosts))
+		for j, host := range domain.Hosts {
+			ipv4, ipv6, enabled := domain.HostIPv4(host), domain.HostIPv6(host), host.IsEnabled()
+			hosts[j] = Host{
+				Name:        host.Name,
+				IPv4:        &ipv4,
+				IPv6:        &ipv6,
+				IPSource:    domain.HostIPSource(host),
+				Enabled:     &enabled,
+				Description: host.Description,
+			}
+		}
+
+		domain.Account = domain.AccountName()
+		if domain.IPSource == "" {
+			domain.IPSource = DefaultIPSource
+		}
+		domain.HostIPSources = nil
+		domain.Hosts = hosts
+		effective.Domains[i] = domain
+	}
+
+	return &effective
+}
+
+// mappingKeys returns the keys of a mapping node including the keys that
+// are merged into it with '<<'.
+func mappingKeys(node *yaml.Node) []string {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	var keys []string
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "<<" {
+				keys = append(keys, mappingKeys(node.Content[i+1])...)
+			} else {
+				keys = append(keys, node.Content[i].Value)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			keys = append(keys, mappingKeys(item)...)
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	content := `
+DEFAULTS:
+  ACCOUNT: work
+  IPV6: true
+  IPV4: false
+  TTL: 300
+  REFRESH: 3600
+  IP-SOURCE: wan1
+  SKIP-MISSING: true
+DOMAINS:
+  - NAME: inherits.de
+  - NAME: explicit.de
+    ACCOUNT: private
+    IPV6: false
+    IPV4: true
+    TTL: 60
+    REFRESH: 0
+    IP-SOURCE: wan2
+    SKIP-MISSING: false
+`
+
+	var config Config
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatal(err)
+	}
+	config.applyDefaults()
+
+	// Only the keys a domain does not set are inherited. Explicit zero and
+	// false values are kept.
+	want := []Domain{
+		{Name: "inherits.de", Account: "work", IPv6: true, IPv4: false, TTL: 300, Refresh: 3600, IPSource: "wan1", SkipMissing: true},
+		{Name: "explicit.de", Account: "private", IPv6: false, IPv4: true, TTL: 60, Refresh: 0, IPSource: "wan2", SkipMissing: false},
+	}
+
+	for i := range config.Domains {
+		got := config.Domains[i]
+		got.set = nil
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("domain %s = %+v, want %+v", got.Name, got, want[i])
+		}
+	}
+
+	if inherited := config.inherited(config.Domains[1]); len(inherited) != 0 {
+		t.Errorf("inherited() of a domain that sets every key = %v", inherited)
+	}
+}
+
+func TestApplyDefaultsUnset(t *testing.T) {
+	// Defaults that are not set are not inherited, so the IPV4 default of
+	// the domain is kept.
+	var config Config
+	if err := yaml.Unmarshal([]byte("DEFAULTS: {TTL: 300}\nDOMAINS: [{NAME: example.de}]\n"), &config); err != nil {
+		t.Fatal(err)
+	}
+	config.applyDefaults()
+
+	domain := config.Domains[0]
+	if !domain.IPv4 || domain.IPv6 || domain.TTL != 300 || domain.Account != "" {
+		t.Errorf("domain = %+v, want IPV4, TTL 300 and no account", domain)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	yes, no := true, false
+
+	config := &Config{
+		Defaults: Defaults{TTL: 300},
+		Domains: []Domain{{
+			Name:          "example.de",
+			IPv4:          true,
+			TTL:           300,
+			HostIPSources: map[string]string{"vpn": "wan2"},
+			Hosts: []Host{
+				{Name: "www", Description: "web"},
+				{Name: "vpn", IPv6: &yes, Enabled: &no},
+			},
+		}},
+	}
+
+	effective := config.Effective()
+
+	want := Domain{
+		Name:     "example.de",
+		Account:  DefaultAccount,
+		IPv4:     true,
+		TTL:      300,
+		IPSource: DefaultIPSource,
+		Hosts: []Host{
+			{Name: "www", IPv4: &yes, IPv6: &no, IPSource: DefaultIPSource, Enabled: &yes, Description: "web"},
+			{Name: "vpn", IPv4: &yes, IPv6: &yes, IPSource: "wan2", Enabled: &no},
+		},
+	}
+	if !reflect.DeepEqual(effective.Domains[0], want) {
+		t.Errorf("Effective() = %+v, want %+v", effective.Domains[0], want)
+	}
+
+	if effective.Defaults != (Defaults{}) {
+		t.Errorf("Effective() kept the defaults %+v", effective.Defaults)
+	}
+
+	// The config itself is not changed.
+	if config.Domains[0].Account != "" || config.Domains[0].HostIPSources == nil || config.Domains[0].Hosts[0].IPv4 != nil {
+		t.Errorf("Effective() changed the config: %+v", config.Domains[0])
+	}
+}
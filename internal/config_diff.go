@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DiffDomains describes the domains and hosts that were added, removed or
+// changed between two configs. It returns one line per change.
+func DiffDomains(old, new *Config) []string {
+	var changes []string
+
+	oldDomains := domainsByName(old.Domains)
+	newDomains := domainsByName(new.Domains)
+
+	for _, domain := range old.Domains {
+		if _, ok := newDomains[domain.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("removed domain %s (hosts %s)", domain.Name, strings.Join(domain.HostNames(), ", ")))
+		}
+	}
+
+	for _, domain := range new.Domains {
+		oldDomain, ok := oldDomains[domain.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("added domain %s (hosts %s)", domain.Name, strings.Join(domain.HostNames(), ", ")))
+			continue
+		}
+
+		oldHosts := hostsByName(oldDomain.Hosts)
+		newHosts := hostsByName(domain.Hosts)
+
+		for _, host := range oldDomain.Hosts {
+			if _, ok := newHosts[host.Name]; !ok {
+				changes = append(changes, fmt.Sprintf("removed host %s of domain %s", host.Name, domain.Name))
+			}
+		}
+
+		for _, host := range domain.Hosts {
+			oldHost, ok := oldHosts[host.Name]
+			if !ok {
+				changes = append(changes, fmt.Sprintf("added host %s to domain %s", host.Name, domain.Name))
+			} else if !reflect.DeepEqual(oldHost, host) {
+				changes = append(changes, fmt.Sprintf("changed settings of host %s of domain %s", host.Name, domain.Name))
+			}
+		}
+
+		// Whether a setting is inherited does not matter, only its value.
+		oldDomain.Hosts, domain.Hosts = nil, nil
+		oldDomain.set, domain.set = nil, nil
+		if !reflect.DeepEqual(oldDomain, domain) {
+			changes = append(changes, fmt.Sprintf("changed settings of domain %s", domain.Name))
+		}
+	}
+
+	return changes
+}
+
+func domainsByName(domains []Domain) map[string]Domain {
+	byName := make(map[string]Domain, len(domains))
+	for _, domain := range domains {
+		byName[domain.Name] = domain
+	}
+
+	return byName
+}
+
+func hostsByName(hosts []Host) map[string]Host {
+	byName := make(map[string]Host, len(hosts))
+	for _, host := range hosts {
+		byName[host.Name] = host
+	}
+
+	return byName
+}
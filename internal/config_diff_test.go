@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDomains(t *testing.T) {
+	ipv6 := true
+
+	tests := []struct {
+		name string
+		old  []Domain
+		new  []Domain
+		want []string
+	}{
+		{
+			name: "unchanged",
+			old:  []Domain{testDomain("example.de", "@", "www")},
+			new:  []Domain{testDomain("example.de", "@", "www")},
+		},
+		{
+			name: "added and removed domains",
+			old:  []Domain{testDomain("example.de", "@", "www"), testDomain("example.com", "www")},
+			new:  []Domain{testDomain("example.com", "www"), testDomain("example.org", "@")},
+			want: []string{
+				"removed domain example.de (hosts @, www)",
+				"added domain example.org (hosts @)",
+			},
+		},
+		{
+			name: "added, removed and changed hosts",
+			old:  []Domain{testDomain("example.de", "@", "www", "mail")},
+			new: []Domain{{
+				Name:  "example.de",
+				IPv4:  true,
+				Hosts: []Host{{Name: "@"}, {Name: "www", IPv6: &ipv6}, {Name: "vpn"}},
+			}},
+			want: []string{
+				"removed host mail of domain example.de",
+				"changed settings of host www of domain example.de",
+				"added host vpn to domain example.de",
+			},
+		},
+		{
+			name: "changed domain",
+			old:  []Domain{testDomain("example.de", "www")},
+			new:  []Domain{{Name: "example.de", IPv4: true, TTL: 60, Hosts: []Host{{Name: "www"}}}},
+			want: []string{"changed settings of domain example.de"},
+		},
+		{
+			name: "inherited setting",
+			old:  []Domain{{Name: "example.de", IPv4: true, TTL: 60, Hosts: []Host{{Name: "www"}}, set: map[string]bool{"TTL": true}}},
+			new:  []Domain{{Name: "example.de", IPv4: true, TTL: 60, Hosts: []Host{{Name: "www"}}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DiffDomains(&Config{Domains: test.old}, &Config{Domains: test.new})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("DiffDomains() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatYAML, FormatJSON and FormatTOML are the supported formats of
+	// config files.
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+
+	// schemaKey is the key editors use to reference the JSON schema of a
+	// file. It is ignored.
+	schemaKey = "$schema"
+)
+
+// DetectFormat returns the format of a config file. The format is detected
+// by the extension of the file and for unknown extensions by its content.
+// Content that is a valid YAML mapping is YAML, because JSON is a subset of
+// YAML and lines like '[a]' or 'a = b' can also appear in YAML strings. Other
+// content is TOML if it can be parsed as TOML.
+func DetectFormat(filename string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSON
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err == nil {
+		if len(document.Content) == 0 || document.Content[0].Kind == yaml.MappingNode {
+			return FormatYAML
+		}
+	}
+
+	var values map[string]interface{}
+	if _, err := toml.Decode(string(content), &values); err == nil {
+		return FormatTOML
+	}
+
+	// The errors are reported by the YAML parser.
+	return FormatYAML
+}
+
+// parseConfigDocument parses a config file in any of the supported formats
+// to a YAML document. JSON is parsed by the YAML parser because it is a
+// subset of YAML. TOML is converted, so all formats are decoded the same way.
+func parseConfigDocument(filename string, content []byte) (*yaml.Node, error) {
+	var document yaml.Node
+
+	switch DetectFormat(filename, content) {
+	case FormatTOML:
+		var values map[string]interface{}
+		metadata, err := toml.Decode(string(content), &values)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) == 0 {
+			return &document, nil
+		}
+
+		var root yaml.Node
+		if err := root.Encode(values); err != nil {
+			return nil, fmt.Errorf("converting toml: %w", err)
+		}
+
+		setTOMLLines(&root, "", tomlLines(content, metadata), 0)
+
+		document.Kind = yaml.DocumentNode
+		document.Content = []*yaml.Node{&root}
+	default:
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	}
+
+	return &document, nil
+}
+
+// tomlLines returns the line of every key of a TOML document by its path like
+// 'DOMAINS[1].TTL'. The decoder does not expose the positions of keys, so the
+// keys, which the metadata contains in the order of the document, are
+// searched in the lines of the content. Tables in arrays of tables are
+// indexed. Keys of inline tables in arrays have no index and are not found by
+// their path.
+func tomlLines(content []byte, metadata toml.MetaData) map[string]int {
+	lines := strings.Split(string(content), "\n")
+	result := make(map[string]int)
+
+	// indexes contains the index of the current table of every array of
+	// tables.
+	indexes := make(map[string]int)
+	line := 0
+
+	for _, key := range metadata.Keys() {
+		var path string
+		for i := range key[:len(key)-1] {
+			path = joinPath(path, key[i])
+			if index, ok := indexes[key[:i+1].String()]; ok {
+				path = fmt.Sprintf("%s[%d]", path, index)
+			}
+		}
+		path = joinPath(path, key[len(key)-1])
+
+		// The header of a table in an array of tables is the position of the
+		// table and of the array if it is the first table.
+		paths := []string{path}
+		if metadata.Type(key...) == "ArrayHash" {
+			name := key.String()
+			index, ok := indexes[name]
+			if !ok {
+				index = -1
+			}
+			for nested := range indexes {
+				if strings.HasPrefix(nested, name+".") {
+					delete(indexes, nested)
+				}
+			}
+			indexes[name] = index + 1
+			paths = append(paths, fmt.Sprintf("%s[%d]", path, index+1))
+		}
+
+		keyRegex := regexp.MustCompile(`(^|[\s{,.\[])["']?` + regexp.QuoteMeta(key[len(key)-1]) + `["']?\s*[=.\]]`)
+		for i := line; i < len(lines); i++ {
+			if keyRegex.MatchString(lines[i]) {
+				line = i
+				for _, path := range paths {
+					if _, ok := result[path]; !ok {
+						result[path] = i + 1
+					}
+				}
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// setTOMLLines sets the lines of the nodes converted from a TOML document.
+// Nodes whose line is unknown get the line of their parent.
+func setTOMLLines(node *yaml.Node, path string, lines map[string]int, line int) {
+	if known, ok := lines[path]; ok {
+		line = known
+	}
+	node.Line = line
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, key.Value)
+			setTOMLLines(value, childPath, lines, line)
+			key.Line = value.Line
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			setTOMLLines(item, fmt.Sprintf("%s[%d]", path, i), lines, line)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     string
+	}{
+		{name: "yml", filename: "config.yml", content: "a = b", want: FormatYAML},
+		{name: "yaml", filename: "config.YAML", content: "{}", want: FormatYAML},
+		{name: "json extension", filename: "config.json", content: "CUSTOMERNR: 1", want: FormatJSON},
+		{name: "toml extension", filename: "config.toml", content: "CUSTOMERNR: 1", want: FormatTOML},
+		{name: "empty", filename: "config", content: "", want: FormatYAML},
+		{name: "yaml content", filename: "config", content: "CUSTOMERNR: 1\nDOMAINS:\n  - NAME: example.de\n", want: FormatYAML},
+		{name: "json content", filename: "config.conf", content: " \n{\"CUSTOMERNR\": 1}", want: FormatJSON},
+		{name: "toml content", filename: "config", content: "CUSTOMERNR = 1\n\n[[DOMAINS]]\nNAME = \"example.de\"\n", want: FormatTOML},
+		{name: "toml assignments only", filename: "config", content: "CUSTOMERNR = 1\nAPIKEY = \"key\"\n", want: FormatTOML},
+		{
+			name:     "yaml with table and assignment lines",
+			filename: "config",
+			content:  "IP-SOURCES:\n  wan:\n    TYPE: exec\n    COMMAND: |\n      [ -n \"$IP\" ] || exit 1\n      IP = $(curl -s ip.example.com)\n",
+			want:     FormatYAML,
+		},
+		{name: "yaml flow sequence", filename: "config", content: "INCLUDE: [conf.d]\nkey = value: 1\n", want: FormatYAML},
+		{name: "invalid", filename: "config", content: "CUSTOMERNR: [1\n", want: FormatYAML},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectFormat(test.filename, []byte(test.content)); got != test.want {
+				t.Errorf("DetectFormat() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yml": `CUSTOMERNR: 1
+APIKEY: key
+APIPASSWORD: password
+IP-SOURCES:
+  wan:
+    TYPE: http
+    URL: https://ip.example.com
+DOMAINS:
+  - NAME: example.de
+    TTL: 300
+    IPV6: true
+    IP-SOURCE: wan
+    HOSTS: [www, {NAME: "@", IPV4: false}]
+`,
+		"config.json": `{
+  "CUSTOMERNR": 1,
+  "APIKEY": "key",
+  "APIPASSWORD": "password",
+  "IP-SOURCES": {"wan": {"TYPE": "http", "URL": "https://ip.example.com"}},
+  "DOMAINS": [{
+    "NAME": "example.de",
+    "TTL": 300,
+    "IPV6": true,
+    "IP-SOURCE": "wan",
+    "HOSTS": ["www", {"NAME": "@", "IPV4": false}]
+  }]
+}
+`,
+		"config.toml": `CUSTOMERNR = 1
+APIKEY = "key"
+APIPASSWORD = "password"
+
+[IP-SOURCES.wan]
+TYPE = "http"
+URL = "https://ip.example.com"
+
+[[DOMAINS]]
+NAME = "example.de"
+TTL = 300
+IPV6 = true
+IP-SOURCE = "wan"
+HOSTS = ["www", { NAME = "@", IPV4 = false }]
+`,
+	}
+
+	dir := t.TempDir()
+	var want *Config
+	for _, name := range []string{"config.yml", "config.json", "config.toml"} {
+		file := filepath.Join(dir, name)
+		writeTestFile(t, file, files[name])
+
+		config, err := (&ConfigLoader{File: file}).Load()
+		if err != nil {
+			t.Fatalf("%s: Load() error = %v", name, err)
+		}
+
+		if want == nil {
+			want = config
+			continue
+		}
+
+		if !reflect.DeepEqual(config.Domains, want.Domains) || !reflect.DeepEqual(config.IPSources, want.IPSources) ||
+			config.CustomerNumber != want.CustomerNumber || config.APIKey != want.APIKey {
+			t.Errorf("%s: Load() = %+v, want %+v", name, config, want)
+		}
+	}
+}
+
+func TestLoadConfigTOMLProblems(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+	writeTestFile(t, file, `CUSTOMERNR = 1
+APIKEY = "key"
+APIPASSWORD = "password"
+IP-SOURCES = { wan = { TYPE = "htp" } }
+
+[[DOMAINS]]
+NAME = "example.de"
+TTL = "300"
+HOSTS = ["www"]
+
+[[DOMAINS]]
+NAME = "example.com"
+TTL = 300
+HOSTS = ["www", "www.example.com"]
+IPV5 = true
+`)
+
+	_, err := (&ConfigLoader{File: file}).Load()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Load() error = %v, want a ValidationError", err)
+	}
+
+	// The type error of the TTL is the only problem of it.
+	want := []string{
+		"config.toml:15: DOMAINS[1].IPV5: unknown key, did you mean 'IPV6'?",
+		"config.toml:8: DOMAINS[0].TTL: cannot unmarshal !!str `300` into int",
+		"config.toml:4: IP-SOURCES.wan: unknown ip source type 'htp'",
+		"config.toml:14: DOMAINS[1].HOSTS[1]: hosts are relative to the domain, use 'www' instead of 'www.example.com'",
+	}
+	assertProblems(t, validationErr, dir, want)
+}
+
+func TestSchemaAcceptsExample(t *testing.T) {
+	schema := loadTestSchema(t)
+
+	content, err := os.ReadFile(filepath.Join("..", "config", "example.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var example interface{}
+	if err := yaml.Unmarshal(content, &example); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := schema.validate(schema.root, example, ""); len(errs) > 0 {
+		t.Errorf("example.yml does not match the schema:\n%s", strings.Join(errs, "\n"))
+	}
+
+	// The check itself rejects invalid configs.
+	invalid := map[string]interface{}{
+		"CUSTOMERNR":      "1",
+		"IP-CACHE-TIMOUT": 300,
+		"IP-SOURCES": map[string]interface{}{
+			"wan": map[string]interface{}{"TYPE": "static", "INTERFACE": "eth0"},
+		},
+		"DOMAINS": []interface{}{map[string]interface{}{"NAME": "example.de", "HOSTS": []interface{}{1}}},
+	}
+	want := []string{
+		"CUSTOMERNR: not of type integer",
+		"DOMAINS[0].HOSTS[0]: matches 0 schemas of oneOf",
+		"IP-CACHE-TIMOUT: additional property",
+		"IP-SOURCES.wan.INTERFACE: not allowed",
+	}
+	if errs := schema.validate(schema.root, invalid, ""); !reflect.DeepEqual(errs, want) {
+		t.Errorf("validate() = %q, want %q", errs, want)
+	}
+}
+
+// testSchema validates values against the subset of JSON schema used by
+// config/schema.json.
+type testSchema struct {
+	root map[string]interface{}
+}
+
+func loadTestSchema(t *testing.T) *testSchema {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("..", "config", "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &testSchema{}
+	if err := json.Unmarshal(content, &schema.root); err != nil {
+		t.Fatal(err)
+	}
+
+	return schema
+}
+
+// validate returns the errors of a value. Unsupported keywords fail the
+// validation, so the schema cannot silently outgrow this check.
+func (s *testSchema) validate(schema interface{}, value interface{}, path string) []string {
+	if allowed, ok := schema.(bool); ok {
+		if allowed {
+			return nil
+		}
+		return []string{path + ": not allowed"}
+	}
+
+	rules := schema.(map[string]interface{})
+	if ref, ok := rules["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		return s.validate(s.root["definitions"].(map[string]interface{})[name], value, path)
+	}
+
+	var errs []string
+	for keyword, rule := range rules {
+		switch keyword {
+		case "$schema", "$id", "title", "description", "default", "definitions", "then":
+		case "type":
+			if !matchesType(rule.(string), value) {
+				return []string{fmt.Sprintf("%s: not of type %s", path, rule)}
+			}
+		case "enum":
+			if !containsValue(rule.([]interface{}), value) {
+				errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, value, rule))
+			}
+		case "minimum":
+			if number, ok := value.(int); ok && float64(number) < rule.(float64) {
+				errs = append(errs, fmt.Sprintf("%s: less than %v", path, rule))
+			}
+		case "minItems":
+			if items, ok := value.([]interface{}); ok && float64(len(items)) < rule.(float64) {
+				errs = append(errs, fmt.Sprintf("%s: less than %v items", path, rule))
+			}
+		case "required":
+			object, _ := value.(map[string]interface{})
+			for _, key := range rule.([]interface{}) {
+				if _, ok := object[key.(string)]; object != nil && !ok {
+					errs = append(errs, fmt.Sprintf("%s: missing %s", path, key))
+				}
+			}
+		case "items":
+			items, _ := value.([]interface{})
+			for i, item := range items {
+				errs = append(errs, s.validate(rule, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		case "properties", "additionalProperties":
+			errs = append(errs, s.validateObject(rules, keyword, value, path)...)
+		case "oneOf":
+			matches := 0
+			for _, option := range rule.([]interface{}) {
+				if len(s.validate(option, value, path)) == 0 {
+					matches++
+				}
+			}
+			if matches != 1 {
+				errs = append(errs, fmt.Sprintf("%s: matches %d schemas of oneOf", path, matches))
+			}
+		case "if":
+			if len(s.validate(rule, value, path)) == 0 {
+				errs = append(errs, s.validate(rules["then"], value, path)...)
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("%s: unsupported keyword %s", path, keyword))
+		}
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// validateObject validates the properties of an object. The properties are
+// validated once for the keyword 'properties'.
+func (s *testSchema) validateObject(rules map[string]interface{}, keyword string, value interface{}, path string) []string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	properties, _ := rules["properties"].(map[string]interface{})
+	if keyword == "properties" {
+		var errs []string
+		for key, property := range properties {
+			if child, ok := object[key]; ok {
+				errs = append(errs, s.validate(property, child, joinPath(path, key))...)
+			}
+		}
+		return errs
+	}
+
+	var errs []string
+	for key, child := range object {
+		if _, ok := properties[key]; ok {
+			continue
+		}
+
+		if additional, ok := rules["additionalProperties"].(bool); ok && !additional {
+			errs = append(errs, joinPath(path, key)+": additional property")
+			continue
+		}
+		errs = append(errs, s.validate(rules["additionalProperties"], child, joinPath(path, key))...)
+	}
+
+	return errs
+}
+
+func matchesType(name string, value interface{}) bool {
+	switch name {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		_, ok := value.(int)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+
+	return false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const includeKey = "INCLUDE"
+
+var (
+	// fragmentKeys are the keys that can be set in included files. The
+	// credentials and global settings stay in the including file, so they can
+	// be owned by someone else than the fragments.
+	fragmentKeys = []string{domainsKey, "IP-SOURCES"}
+
+	// fragmentExtensions are the extensions of the files that are included
+	// from a directory.
+	fragmentExtensions = []string{".yml", ".yaml", ".json", ".toml"}
+
+	errIncludeKey = errors.New("INCLUDE can only be set in config files")
+)
+
+// loadIncludes loads the files matching the INCLUDE patterns of a config file
+// into the config. Patterns are relative to the directory of the file.
+func loadIncludes(config *Config, filename string, patterns []string) error {
+	dir := filepath.Dir(filename)
+
+	for i, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		config.includes = append(config.includes, pattern)
+
+		files, err := includeFiles(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %s[%d]: %w", filename, includeKey, i, err)
+		}
+
+		for _, file := range files {
+			if file == filepath.Clean(filename) || Contains(config.fragments, file) {
+				continue
+			}
+
+			if err := loadFragment(config, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// includeFiles returns the files matching a pattern in lexical order. A
+// directory matches all config files in it. Patterns without wildcards must
+// match an existing file.
+func includeFiles(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		var files []string
+		for _, entry := range entries {
+			if !entry.IsDir() && Contains(fragmentExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+				files = append(files, filepath.Join(pattern, entry.Name()))
+			}
+		}
+
+		return files, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+		_, err := os.Stat(pattern)
+		return nil, err
+	}
+
+	var files []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, filepath.Clean(match))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// loadFragment loads an included file. Its domains are appended to the
+// domains of the config and its ip sources are added to the ip sources.
+// Defining an ip source twice is a problem. Domains defined twice are
+// reported by the validation.
+func loadFragment(config *Config, filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	document, err := parseConfigDocument(filename, content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	config.fragments = append(config.fragments, filename)
+	if len(document.Content) == 0 {
+		return nil
+	}
+
+	fragment := &Config{}
+	walker := &nodeWalker{config: fragment, filename: filename}
+	walker.walk(document, reflect.TypeOf(fragment), "", 0)
+
+	if err := walker.decode(document); err != nil {
+		return err
+	}
+
+	if root := document.Content[0]; root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key := root.Content[i]
+			_, known := structFieldByExactKey(reflect.TypeOf(*fragment), key.Value)
+			if known && !Contains(fragmentKeys, key.Value) {
+				fragment.problems = append(fragment.problems, Problem{
+					Path:     key.Value,
+					Position: walker.position(key.Line),
+					Message:  fmt.Sprintf("can not be set in included files, only %s can", strings.Join(fragmentKeys, " and ")),
+				})
+			}
+		}
+	}
+
+	offset := len(config.Domains)
+	for _, problem := range fragment.problems {
+		problem.Path = shiftDomainPath(problem.Path, offset)
+		config.problems = append(config.problems, problem)
+	}
+
+	added := make(map[string]bool)
+	for _, name := range sortedNames(fragment.IPSources) {
+		path := "IP-SOURCES." + name
+		if _, ok := config.IPSources[name]; ok {
+			config.problems = append(config.problems, Problem{
+				Path:     path,
+				Position: fragment.position(path),
+				Message:  fmt.Sprintf("ip source '%s' is already defined%s", name, inParens(config.position(path))),
+			})
+			continue
+		}
+
+		if config.IPSources == nil {
+			config.IPSources = make(map[string]IPSourceConfig)
+		}
+		config.IPSources[name] = fragment.IPSources[name]
+		added[name] = true
+	}
+
+	if config.positions == nil {
+		config.positions = make(map[string]string)
+	}
+	for path, position := range fragment.positions {
+		name, isSource := strings.CutPrefix(path, "IP-SOURCES.")
+		name, _, _ = strings.Cut(name, ".")
+		if strings.HasPrefix(path, domainsKey+"[") || (isSource && added[name]) {
+			config.positions[shiftDomainPath(path, offset)] = position
+		}
+	}
+
+	config.Domains = append(config.Domains, fragment.Domains...)
+
+	return nil
+}
+
+// shiftDomainPath adds an offset to the index of a path below DOMAINS.
+func shiftDomainPath(path string, offset int) string {
+	rest, ok := strings.CutPrefix(path, domainsKey+"[")
+	if !ok {
+		return path
+	}
+
+	index, rest, ok := strings.Cut(rest, "]")
+	i, err := strconv.Atoi(index)
+	if !ok || err != nil {
+		return path
+	}
+
+	return fmt.Sprintf("%s[%d]%s", domainsKey, i+offset, rest)
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const includeAccount = "CUSTOMERNR: 1\nAPIKEY: key\nAPIPASSWORD: password\n"
+
+// writeTestFiles writes files relative to a directory and creates their
+// directories.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, file, content)
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yml": includeAccount +
+			"INCLUDE: [conf.d, 'extra/*.yml', single.toml, conf.d/10-a.json, '*.yml', 'missing/*.yml']\n" +
+			"DOMAINS: [{NAME: main.de, TTL: 300, HOSTS: [www]}]\n",
+		"conf.d/20-b.yml":     "DOMAINS: [{NAME: b.de, TTL: 300, HOSTS: [www], IP-SOURCE: wan2}]\n",
+		"conf.d/10-a.json":    `{"DOMAINS": [{"NAME": "a.de", "TTL": 300, "HOSTS": ["www"]}]}`,
+		"conf.d/notes.txt":    "DOMAINS: [{NAME: ignored.de}]\n",
+		"conf.d/sub/30-c.yml": "DOMAINS: [{NAME: ignored.de}]\n",
+		"conf.d/empty.yml":    "",
+		"extra/sources.yml":   "IP-SOURCES:\n  wan2: {TYPE: static, IPV4: 192.0.2.1}\n",
+		"extra/d.yml":         "DOMAINS: [{NAME: d.de, TTL: 300, HOSTS: [www]}]\n",
+		"single.toml":         "[[DOMAINS]]\nNAME = \"e.de\"\nTTL = 300\nHOSTS = [\"www\"]\n",
+	})
+
+	loader := &ConfigLoader{File: filepath.Join(dir, "config.yml")}
+	config, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files of a directory and of a glob are included in lexical order and
+	// every file only once.
+	var names []string
+	for _, domain := range config.Domains {
+		names = append(names, domain.Name)
+	}
+	if want := []string{"main.de", "a.de", "b.de", "d.de", "e.de"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("domains = %v, want %v", names, want)
+	}
+
+	if source, ok := config.IPSources["wan2"]; !ok || source.IPv4 != "192.0.2.1" {
+		t.Errorf("IP-SOURCES.wan2 = %+v, want the included source", source)
+	}
+
+	if got, want := config.position("DOMAINS[2].TTL"), filepath.Join(dir, "conf.d", "20-b.yml")+":1"; got != want {
+		t.Errorf("position of DOMAINS[2].TTL = %q, want %q", got, want)
+	}
+
+	// Adding a file to an included directory changes the stamp.
+	stamp := loader.Stamp()
+	writeTestFile(t, filepath.Join(dir, "conf.d", "40-f.yml"), "DOMAINS: [{NAME: f.de, TTL: 300, HOSTS: [www]}]\n")
+	if loader.Stamp() == stamp {
+		t.Error("Stamp() did not change after adding an included file")
+	}
+}
+
+func TestLoadIncludesProblems(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yml": includeAccount +
+			"IP-SOURCES:\n  wan2: {TYPE: static, IPV4: 192.0.2.1}\n" +
+			"INCLUDE: [conf.d]\n" +
+			"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+		"conf.d/a.yml": "APIKEY: other\n" +
+			"IP-CACHE-TIMEOUT: 30\n" +
+			"INCLUDE: [more]\n" +
+			"IP-SOURCES:\n  wan2: {TYPE: static, IPV4: 192.0.2.2}\n" +
+			"DOMAINS:\n" +
+			"  - NAME: other.de\n" +
+			"    TTL: 0\n" +
+			"    HOSTS: [www]\n" +
+			"  - NAME: example.de\n" +
+			"    TTL: 300\n" +
+			"    HOSTS: [www]\n",
+	})
+
+	_, err := (&ConfigLoader{File: filepath.Join(dir, "config.yml")}).Load()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Load() error = %v, want a ValidationError", err)
+	}
+
+	want := []string{
+		"conf.d/a.yml:1: APIKEY: can not be set in included files, only DOMAINS and IP-SOURCES can",
+		"conf.d/a.yml:2: IP-CACHE-TIMEOUT: can not be set in included files, only DOMAINS and IP-SOURCES can",
+		"conf.d/a.yml:3: INCLUDE: can not be set in included files, only DOMAINS and IP-SOURCES can",
+		"conf.d/a.yml:5: IP-SOURCES.wan2: ip source 'wan2' is already defined (config.yml:5)",
+		"conf.d/a.yml:8: DOMAINS[1].TTL: must be greater than 0",
+		"conf.d/a.yml:10: DOMAINS[2].NAME: domain 'example.de' is already configured at DOMAINS[0] (config.yml:7)",
+	}
+	assertProblems(t, validationErr, dir, want)
+}
+
+func TestLoadIncludesMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yml": includeAccount + "INCLUDE: [missing.yml]\nDOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+	})
+
+	_, err := (&ConfigLoader{File: filepath.Join(dir, "config.yml")}).Load()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	config := &Config{}
+	if err := config.Set("include", "[conf.d]"); err != errIncludeKey {
+		t.Errorf("Set(INCLUDE) error = %v, want %v", err, errIncludeKey)
+	}
+}
@@ -0,0 +1,511 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SystemConfigFile is the location of the system wide config file.
+	SystemConfigFile = "/etc/dyndns-netcup-go/config.yml"
+
+	// EnvPrefix is the prefix of the environment variables that override
+	// config keys. The key 'IP-CACHE-TIMEOUT' is overridden by the environment
+	// variable 'DYNDNS_IP_CACHE_TIMEOUT' for example.
+	EnvPrefix = "DYNDNS_"
+
+	userConfigDir  = "dyndns-netcup-go"
+	userConfigFile = "config.yml"
+	domainsKey     = "DOMAINS"
+)
+
+// ConfigLoader loads a Config from several layers. Every layer overrides the
+// keys it specifies in the layers before. The layers in order of precedence
+// are the defaults, the SystemFile, the UserFile, the File, the environment
+// variables with the EnvPrefix and the Overrides.
+type ConfigLoader struct {
+	// SystemFile and UserFile are skipped if they do not exist.
+	SystemFile string
+	UserFile   string
+	// File is the config file specified by the user. It is skipped if it
+	// does not exist and FileOptional is set.
+	File         string
+	FileOptional bool
+	// Env contains environment variables in the form 'KEY=VALUE'.
+	Env []string
+	// Overrides contain config keys and values in the form 'KEY=VALUE'.
+	Overrides []string
+	// SecretDirs are the directories the api key and password are looked
+	// up in if they are not configured.
+	SecretDirs []string
+	// Logger logs warnings like environment variables with the EnvPrefix
+	// that match no key. Warnings are dropped if it is nil.
+	Logger *Logger
+
+	// includes are the INCLUDE patterns of the last load.
+	includes []string
+}
+
+// NewConfigLoader returns a ConfigLoader for a specified config file. The
+// system and user config files as well as the environment variables of the
+// process are used. Warnings are logged with the specified logger.
+func NewConfigLoader(file string, optional bool, logger *Logger) *ConfigLoader {
+	loader := &ConfigLoader{
+		SystemFile:   SystemConfigFile,
+		File:         file,
+		FileOptional: optional,
+		Env:          os.Environ(),
+		SecretDirs:   DefaultSecretDirs(),
+		Logger:       logger,
+	}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		loader.UserFile = filepath.Join(dir, userConfigDir, userConfigFile)
+	}
+
+	return loader
+}
+
+// Load loads the config from all layers.
+func (l *ConfigLoader) Load() (*Config, error) {
+	config := defaultConfig()
+
+	for _, file := range []string{l.SystemFile, l.UserFile} {
+		err := config.applyLayer(func() error { return loadConfigFile(config, file, true) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := config.applyLayer(func() error { return loadConfigFile(config, l.File, l.FileOptional) })
+	if err != nil {
+		return nil, err
+	}
+	l.includes = config.includes
+
+	if err := config.applyLayer(func() error { return l.setEnv(config) }); err != nil {
+		return nil, err
+	}
+
+	if err := config.applyLayer(func() error { return config.setOverrides(l.Overrides) }); err != nil {
+		return nil, err
+	}
+
+	config.applyDefaults()
+
+	if err := config.resolveSecrets(l.SecretDirs); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// setEnv sets the keys specified by environment variables with the
+// EnvPrefix. Variables that match no key are only warned about, because the
+// environment is often shared with other programs.
+func (l *ConfigLoader) setEnv(c *Config) error {
+	for _, variable := range l.Env {
+		key, value, found := strings.Cut(variable, "=")
+		if !found || !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+
+		name := key
+		key = strings.ReplaceAll(strings.TrimPrefix(key, EnvPrefix), "_", "-")
+		if err := c.Set(key, value); err != nil {
+			if err == errUnknownKey {
+				if problem, ok := c.unknownEnv(name); ok && l.Logger != nil {
+					l.Logger.Warning("%s", problem)
+				}
+				continue
+			}
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		c.setPosition(canonicalKey(key), envPosition(name))
+	}
+
+	return nil
+}
+
+// setOverrides sets the keys specified in the form 'KEY=VALUE'.
+func (c *Config) setOverrides(overrides []string) error {
+	for _, override := range overrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found {
+			return fmt.Errorf("override '%s' is not in the form KEY=VALUE", override)
+		}
+
+		if err := c.Set(key, value); err != nil {
+			return fmt.Errorf("override %s: %w", key, err)
+		}
+		c.setPosition(canonicalKey(key), overridePosition(key))
+	}
+
+	return nil
+}
+
+// secretKeys contains the keys of the secrets and the keys of the files they
+// are read from.
+var secretKeys = [][2]string{
+	{"APIKEY", "APIKEY-FILE"},
+	{"APIPASSWORD", "APIPASSWORD-FILE"},
+}
+
+// applyLayer applies a layer to the config. A secret that is set by the
+// layer replaces the file of the secret set by a lower layer and vice versa.
+// The layers that set a key are told apart by its position.
+func (c *Config) applyLayer(apply func() error) error {
+	before := make(map[string]string)
+	for _, keys := range secretKeys {
+		for _, key := range keys {
+			before[key] = c.positions[key]
+		}
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	for _, keys := range secretKeys {
+		valueSet := c.positions[keys[0]] != before[keys[0]]
+		fileSet := c.positions[keys[1]] != before[keys[1]]
+
+		if valueSet && !fileSet {
+			c.clearKey(keys[1])
+		}
+		if fileSet && !valueSet {
+			c.clearKey(keys[0])
+		}
+	}
+
+	return nil
+}
+
+// clearKey resets a top level key to its zero value.
+func (c *Config) clearKey(key string) {
+	field, ok := fieldByKey(reflect.ValueOf(c).Elem(), key)
+	if !ok {
+		return
+	}
+
+	field.Set(reflect.Zero(field.Type()))
+	delete(c.positions, key)
+}
+
+// Stamp returns a value that changes whenever the content of one of the
+// config files changes. Files that do not exist are part of the stamp as
+// well, so creating them changes it. The files included by the last Load are
+// matched again, so adding a file to an included directory changes it too.
+func (l *ConfigLoader) Stamp() string {
+	files := []string{l.SystemFile, l.UserFile, l.File}
+	for _, pattern := range l.includes {
+		included, _ := includeFiles(pattern)
+		files = append(files, included...)
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+
+		hash.Write([]byte(file))
+		if content, err := ioutil.ReadFile(file); err == nil {
+			hash.Write(content)
+		}
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		IPCacheBackend: StateBackendFile,
+	}
+}
+
+// loadConfigFile loads a config file in any of the supported formats on top
+// of a specified config. Keys that are not present in the file keep their
+// value. Unknown keys and values of the wrong type are recorded as problems
+// of the config.
+func loadConfigFile(config *Config, filename string, optional bool) error {
+	if filename == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	document, err := parseConfigDocument(filename, content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if len(document.Content) == 0 {
+		return nil
+	}
+
+	walker := &nodeWalker{config: config, filename: filename}
+	walker.walk(document, reflect.TypeOf(config), "", 0)
+
+	// Only the includes of this file are loaded, not the ones of the files
+	// before.
+	config.Include = nil
+
+	if err := walker.decode(document); err != nil {
+		return err
+	}
+
+	return loadIncludes(config, filename, config.Include)
+}
+
+var errUnknownKey = fmt.Errorf("unknown config key")
+
+// Set sets the config key to a specified value. The key is matched case
+// insensitive against the keys of the config file. Strings, numbers and
+// booleans are set as they are. Lists and maps are specified in YAML flow
+// syntax like '{wan1: {TYPE: ipify}}'. The domains can also be specified in
+// the compact syntax described at ParseDomains.
+func (c *Config) Set(key, value string) error {
+	field, ok := fieldByKey(reflect.ValueOf(c).Elem(), key)
+	if !ok {
+		return errUnknownKey
+	}
+
+	if strings.EqualFold(key, includeKey) {
+		return errIncludeKey
+	}
+
+	if strings.EqualFold(key, domainsKey) && !isFlowSyntax(value) {
+		domains, err := ParseDomains(value)
+		if err != nil {
+			return err
+		}
+
+		c.Domains = domains
+		return nil
+	}
+
+	if err := setField(field, value); err != nil {
+		return err
+	}
+
+	// Type errors of domains are kept by the domains instead of returned.
+	if typeErr := c.takeTypeErrors(); typeErr != nil {
+		return typeErr
+	}
+
+	return nil
+}
+
+// unknownEnv returns the problem of an environment variable with the
+// EnvPrefix that does not match a key, e.g. because of a typo. The variable
+// that is passed to exec ip sources is not a key and has no problem.
+func (c *Config) unknownEnv(name string) (Problem, bool) {
+	if name == familyEnv {
+		return Problem{}, false
+	}
+
+	var names []string
+	for _, key := range structKeys(reflect.TypeOf(*c)) {
+		names = append(names, EnvPrefix+strings.ReplaceAll(key, "-", "_"))
+	}
+
+	return Problem{
+		Position: envPosition(name),
+		Message:  "unknown key" + suggest(name, names),
+	}, true
+}
+
+// ParseDomains parses domains in the compact syntax. Domains are separated
+// by semicolons. Every domain starts with its name optionally followed by a
+// colon and comma separated options in the form 'KEY=VALUE'. The keys are the
+// keys of a domain in the config file. Lists are separated by spaces or '|'
+// and map entries have the form 'KEY=VALUE'. For example:
+//
+//	example.de:ttl=300,ipv6=true,hosts=@|*|www;example.com:hosts=@
+func ParseDomains(value string) ([]Domain, error) {
+	var raw []map[string]interface{}
+
+	for _, spec := range strings.Split(value, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(spec, ":")
+		domain := map[string]interface{}{"NAME": strings.TrimSpace(name)}
+
+		for _, option := range strings.Split(options, ",") {
+			if strings.TrimSpace(option) == "" {
+				continue
+			}
+
+			key, optionValue, found := strings.Cut(option, "=")
+			if !found {
+				return nil, fmt.Errorf("domain %s: option '%s' is not in the form KEY=VALUE", name, option)
+			}
+
+			parsed, tag, err := parseDomainOption(strings.TrimSpace(key), strings.TrimSpace(optionValue))
+			if err != nil {
+				return nil, fmt.Errorf("domain %s: %w", name, err)
+			}
+			domain[tag] = parsed
+		}
+
+		raw = append(raw, domain)
+	}
+
+	// The domains are decoded from YAML to apply the same defaults as in
+	// the config file.
+	content, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	err = yaml.Unmarshal(content, &config.Domains)
+	if err != nil {
+		return nil, err
+	}
+
+	if typeErr := config.takeTypeErrors(); typeErr != nil {
+		return nil, typeErr
+	}
+
+	return config.Domains, nil
+}
+
+// parseDomainOption converts the value of a domain option in the compact
+// syntax to the type of the corresponding field. It returns the value and the
+// key of the field.
+func parseDomainOption(key, value string) (interface{}, string, error) {
+	field, ok := structFieldByKey(reflect.TypeOf(Domain{}), key)
+	if !ok {
+		return nil, "", fmt.Errorf("unknown key '%s'", key)
+	}
+
+	tag := yamlKey(field)
+	splitList := func(value string) []string {
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == '|' })
+	}
+
+	switch field.Type.Kind() {
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		return parsed, tag, err
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		return parsed, tag, err
+	case reflect.Slice:
+		return splitList(value), tag, nil
+	case reflect.Map:
+		entries := make(map[string]string)
+		for _, entry := range splitList(value) {
+			entryKey, entryValue, found := strings.Cut(entry, "=")
+			if !found {
+				return nil, "", fmt.Errorf("%s: entry '%s' is not in the form KEY=VALUE", key, entry)
+			}
+			entries[entryKey] = entryValue
+		}
+		return entries, tag, nil
+	default:
+		return value, tag, nil
+	}
+}
+
+// setField sets a field to a value given as string.
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	default:
+		target := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(value), target.Interface()); err != nil {
+			return err
+		}
+		field.Set(target.Elem())
+	}
+
+	return nil
+}
+
+// fieldByKey returns the field of a struct value that has a specified key in
+// the config file.
+func fieldByKey(value reflect.Value, key string) (reflect.Value, bool) {
+	field, ok := structFieldByKey(value.Type(), key)
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	return value.FieldByIndex(field.Index), true
+}
+
+// structFieldByKey returns the field of a struct type that has a specified
+// key in the config file. The key is matched case insensitive.
+func structFieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tag := yamlKey(field); tag != "" && strings.EqualFold(tag, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// canonicalKey returns the key of the config as written in the config file
+// for a key that is matched case insensitive.
+func canonicalKey(key string) string {
+	if field, ok := structFieldByKey(reflect.TypeOf(Config{}), key); ok {
+		return yamlKey(field)
+	}
+
+	return key
+}
+
+// yamlKey returns the key of a struct field in the config file.
+func yamlKey(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if tag == "-" {
+		return ""
+	}
+
+	return tag
+}
+
+func isFlowSyntax(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{")
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []Domain
+		wantErr bool
+	}{
+		{
+			name:  "name only",
+			value: "example.de",
+			want:  []Domain{{Name: "example.de", IPv4: true}},
+		},
+		{
+			name:  "options",
+			value: "example.de:ttl=300,ipv6=true,ipv4=false,hosts=@|*|www",
+			want: []Domain{{
+				Name:  "example.de",
+				IPv6:  true,
+				TTL:   300,
+				Hosts: []Host{{Name: "@"}, {Name: "*"}, {Name: "www"}},
+			}},
+		},
+		{
+			name:  "several domains",
+			value: " example.de:hosts=@ ; example.com:IP-SOURCE=wan1,host-ip-sources=www=wan2 ;",
+			want: []Domain{
+				{Name: "example.de", IPv4: true, Hosts: []Host{{Name: "@"}}},
+				{Name: "example.com", IPv4: true, IPSource: "wan1", HostIPSources: map[string]string{"www": "wan2"}},
+			},
+		},
+		{
+			name:    "option without value",
+			value:   "example.de:ttl",
+			wantErr: true,
+		},
+		{
+			name:    "unknown option",
+			value:   "example.de:tll=300",
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			value:   "example.de:ttl=five",
+			wantErr: true,
+		},
+		{
+			name:    "invalid map entry",
+			value:   "example.de:host-ip-sources=www",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseDomains(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseDomains() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			// The keys that were set are not compared.
+			for i := range got {
+				got[i].set = nil
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseDomains() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// errInvalid marks test cases that expect any error.
+var errInvalid = errors.New("invalid")
+
+func TestConfigSet(t *testing.T) {
+	tests := []struct {
+		key, value string
+		check      func(*Config) bool
+		// wantErr is the expected error. It is only matched with errors.Is
+		// if it is not errInvalid.
+		wantErr error
+	}{
+		{
+			key:   "ip-cache-timeout",
+			value: "30",
+			check: func(c *Config) bool { return c.IPCacheTimeout == 30 },
+		},
+		{
+			key:   "APIKEY",
+			value: "key",
+			check: func(c *Config) bool { return c.APIKey == "key" },
+		},
+		{
+			key:   "IP-SOURCES",
+			value: "{wan1: {TYPE: static, IPV4: 203.0.113.1}}",
+			check: func(c *Config) bool { return c.IPSources["wan1"].IPv4 == "203.0.113.1" },
+		},
+		{
+			key:   "DOMAINS",
+			value: "example.de:hosts=www",
+			check: func(c *Config) bool { return len(c.Domains) == 1 && c.Domains[0].Hosts[0].Name == "www" },
+		},
+		{
+			key:   "DOMAINS",
+			value: "[{NAME: example.de, HOSTS: [www]}]",
+			check: func(c *Config) bool { return len(c.Domains) == 1 && c.Domains[0].IPv4 },
+		},
+		{
+			key:     "IP-CACHE-TIMEOUT",
+			value:   "thirty",
+			wantErr: errInvalid,
+		},
+		{
+			key:     "DOMAINS",
+			value:   "[{NAME: example.de, TTL: five}]",
+			wantErr: errInvalid,
+		},
+		{
+			key:     "IP-CACHE-TIMOUT",
+			value:   "30",
+			wantErr: errUnknownKey,
+		},
+		{
+			key:     "INCLUDE",
+			value:   "[conf.d/*.yml]",
+			wantErr: errIncludeKey,
+		},
+	}
+
+	for _, test := range tests {
+		config := defaultConfig()
+		err := config.Set(test.key, test.value)
+		if test.wantErr != nil {
+			if err == nil || test.wantErr != errInvalid && !errors.Is(err, test.wantErr) {
+				t.Errorf("Set(%s) error = %v, want %v", test.key, err, test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Set(%s) error = %v", test.key, err)
+		} else if !test.check(config) {
+			t.Errorf("Set(%s, %s) did not set the value", test.key, test.value)
+		}
+	}
+
+}
+
+func TestConfigLoaderPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	user := filepath.Join(dir, "user.yml")
+
+	writeTestFile(t, user, "CUSTOMERNR: 1\nAPIKEY: user\nAPIPASSWORD: user\nIP-CACHE-TIMEOUT: 10\n")
+	writeTestFile(t, file, "APIKEY: file\nIP-CACHE-TIMEOUT: 20\nDOMAINS:\n  - NAME: example.de\n    TTL: 300\n    HOSTS: [www]\n")
+
+	loader := &ConfigLoader{
+		UserFile: user,
+		File:     file,
+		Env: []string{
+			"DYNDNS_IP_CACHE_TIMEOUT=30",
+			"DYNDNS_APIPASSWORD=env",
+			"HOME=/root",
+		},
+		Overrides: []string{"ip-cache-timeout=40"},
+	}
+
+	config, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.CustomerNumber != 1 || config.APIKey != "file" || config.APIPassword != "env" || config.IPCacheTimeout != 40 {
+		t.Errorf("Load() = CUSTOMERNR %d, APIKEY %s, APIPASSWORD %s, IP-CACHE-TIMEOUT %d, want 1, file, env, 40",
+			config.CustomerNumber, config.APIKey, config.APIPassword, config.IPCacheTimeout)
+	}
+
+	if position := config.position("IP-CACHE-TIMEOUT"); position != overridePosition("ip-cache-timeout") {
+		t.Errorf("position of IP-CACHE-TIMEOUT = %q", position)
+	}
+	if position := config.position("APIPASSWORD"); position != envPosition("DYNDNS_APIPASSWORD") {
+		t.Errorf("position of APIPASSWORD = %q", position)
+	}
+
+	loader.Overrides = []string{"ip-cache-timeout"}
+	if _, err := loader.Load(); err == nil {
+		t.Error("expected an error for an override without value")
+	}
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
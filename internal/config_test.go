@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFingerprint(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			IPSources: map[string]IPSourceConfig{
+				"wan1": {Type: ipSourceStatic, IPv4: "203.0.113.1"},
+				"wan2": {Type: ipSourceStatic, IPv4: "203.0.113.2"},
+			},
+			Domains: []Domain{{
+				Name:     "example.de",
+				IPv4:     true,
+				TTL:      300,
+				IPSource: "wan1",
+				Hosts:    []Host{{Name: "@"}, {Name: "www"}},
+			}},
+		}
+	}
+
+	base := newConfig()
+	want, err := base.Fingerprint(base.Domains[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		changed bool
+	}{
+		{
+			name:   "host order",
+			change: func(c *Config) { c.Domains[0].Hosts = []Host{{Name: "www"}, {Name: "@"}} },
+		},
+		{
+			name:   "unreferenced ip source",
+			change: func(c *Config) { c.IPSources["wan2"] = IPSourceConfig{Type: ipSourceStatic, IPv4: "203.0.113.3"} },
+		},
+		{
+			name:    "ttl",
+			change:  func(c *Config) { c.Domains[0].TTL = 600 },
+			changed: true,
+		},
+		{
+			name:    "added host",
+			change:  func(c *Config) { c.Domains[0].Hosts = append(c.Domains[0].Hosts, Host{Name: "mail"}) },
+			changed: true,
+		},
+		{
+			name:    "referenced ip source",
+			change:  func(c *Config) { c.IPSources["wan1"] = IPSourceConfig{Type: ipSourceStatic, IPv4: "203.0.113.3"} },
+			changed: true,
+		},
+		{
+			name: "host ip source",
+			change: func(c *Config) {
+				c.Domains[0].HostIPSources = map[string]string{"www": "wan2"}
+			},
+			changed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := newConfig()
+			test.change(config)
+
+			got, err := config.Fingerprint(config.Domains[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (got != want) != test.changed {
+				t.Errorf("fingerprint changed = %v, want %v", got != want, test.changed)
+			}
+		})
+	}
+}
+
+func TestFingerprintSecrets(t *testing.T) {
+	config := &Config{
+		IPSources: map[string]IPSourceConfig{
+			"api": {
+				Type:    ipSourceHTTP,
+				URL:     "https://ip.example.com",
+				Headers: Headers{"Authorization": "Bearer token"},
+			},
+			"script": {Type: ipSourceExec, Command: "ip", Env: map[string]string{"TOKEN": "token"}},
+		},
+		Domains: []Domain{
+			{Name: "example.de", IPv4: true, TTL: 300, IPSource: "api", Hosts: []Host{{Name: "www"}}},
+			{Name: "example.com", IPv4: true, TTL: 300, IPSource: "script", Hosts: []Host{{Name: "www"}}},
+		},
+	}
+
+	var before []string
+	for _, domain := range config.Domains {
+		fingerprint, err := config.Fingerprint(domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before = append(before, fingerprint)
+	}
+
+	// The credentials are redacted when the config is encoded, but changing
+	// them still changes the fingerprints.
+	config.IPSources["api"].Headers["Authorization"] = "Bearer other"
+	config.IPSources["script"].Env["TOKEN"] = "other"
+
+	for i, domain := range config.Domains {
+		fingerprint, err := config.Fingerprint(domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fingerprint == before[i] {
+			t.Errorf("fingerprint of %s did not change with its ip source", domain.Name)
+		}
+	}
+}
+
+func TestFingerprintAfterSelect(t *testing.T) {
+	config := &Config{Domains: []Domain{{Name: "example.de", IPv4: true, TTL: 300, Hosts: []Host{{Name: "@"}, {Name: "www"}}}}}
+
+	want, err := config.Fingerprint(config.Domains[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Select(nil, []string{"www"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A selection must not invalidate the entries of the other hosts.
+	got, err := config.Fingerprint(config.Domains[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Error("fingerprint changed after selecting a host")
+	}
+}
+
+func TestConfigAccount(t *testing.T) {
+	config := &Config{
+		CustomerNumber: 1,
+		APIKey:         "key",
+		APIPassword:    "password",
+		Accounts: map[string]Account{
+			"work": {CustomerNumber: 2, APIKey: "work-key", APIPassword: "work-password"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		config  *Config
+		account string
+		want    Account
+		wantOk  bool
+	}{
+		{
+			name:    "default account from the top level credentials",
+			config:  config,
+			account: DefaultAccount,
+			want:    Account{CustomerNumber: 1, APIKey: "key", APIPassword: "password"},
+			wantOk:  true,
+		},
+		{
+			name:    "named account",
+			config:  config,
+			account: "work",
+			want:    Account{CustomerNumber: 2, APIKey: "work-key", APIPassword: "work-password"},
+			wantOk:  true,
+		},
+		{
+			name:    "unknown account",
+			config:  config,
+			account: "private",
+		},
+		{
+			name: "default account from the accounts",
+			config: &Config{Accounts: map[string]Account{
+				DefaultAccount: {CustomerNumber: 3, APIKey: "default-key", APIPassword: "default-password"},
+			}},
+			account: DefaultAccount,
+			want:    Account{CustomerNumber: 3, APIKey: "default-key", APIPassword: "default-password"},
+			wantOk:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.config.Account(test.account)
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("Account(%s) = %+v, %t, want %+v, %t", test.account, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestConfigAccountNames(t *testing.T) {
+	config := &Config{Domains: []Domain{
+		{Name: "example.com", Account: "work"},
+		{Name: "example.de"},
+		{Name: "example.org", Account: "work"},
+		{Name: "example.net", Account: DefaultAccount},
+	}}
+
+	if got, want := config.AccountNames(), []string{"work", DefaultAccount}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AccountNames() = %v, want %v", got, want)
+	}
+}
+
+func TestHostUnmarshalYAML(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name        string
+		content     string
+		want        Host
+		wantTypeErr bool
+	}{
+		{name: "scalar", content: "www", want: Host{Name: "www"}},
+		{name: "wildcard", content: "'*'", want: Host{Name: "*"}},
+		{name: "number", content: "1", want: Host{Name: "1"}},
+		{name: "mapping with name only", content: "{NAME: www}", want: Host{Name: "www"}},
+		{
+			name:    "mapping",
+			content: "{NAME: vpn, IPV4: false, IPV6: true, IP-SOURCE: wan2, ENABLED: false, DESCRIPTION: office}",
+			want:    Host{Name: "vpn", IPv4: &no, IPv6: &yes, IPSource: "wan2", Enabled: &no, Description: "office"},
+		},
+		{
+			name:        "type error keeps the other settings",
+			content:     "{NAME: vpn, IPV6: maybe, IP-SOURCE: wan2}",
+			want:        Host{Name: "vpn", IPv6: &no, IPSource: "wan2"},
+			wantTypeErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var host Host
+			if err := yaml.Unmarshal([]byte(test.content), &host); err != nil {
+				t.Fatal(err)
+			}
+
+			if (host.typeErr != nil) != test.wantTypeErr {
+				t.Errorf("type error = %v, want %t", host.typeErr, test.wantTypeErr)
+			}
+
+			host.typeErr = nil
+			if !reflect.DeepEqual(host, test.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", host, test.want)
+			}
+
+			// A host is encoded in the same form.
+			encoded, err := yaml.Marshal(host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded Host
+			if err := yaml.Unmarshal(encoded, &decoded); err != nil || !reflect.DeepEqual(decoded, host) {
+				t.Errorf("Unmarshal(Marshal()) = %+v, %v, want %+v", decoded, err, host)
+			}
+		})
+	}
+}
+
+func TestDomainHostSettings(t *testing.T) {
+	yes, no := true, false
+
+	domain := Domain{
+		Name:          "example.de",
+		IPv4:          true,
+		IPSource:      "wan1",
+		HostIPSources: map[string]string{"mail": "wan2", "vpn": "wan2"},
+		Hosts: []Host{
+			{Name: "www"},
+			{Name: "mail"},
+			{Name: "vpn", IPv4: &no, IPv6: &yes, IPSource: "wan3", Enabled: &yes},
+			{Name: "old", Enabled: &no},
+		},
+	}
+
+	tests := []struct {
+		host     Host
+		ipv4     bool
+		ipv6     bool
+		ipSource string
+	}{
+		{host: domain.Hosts[0], ipv4: true, ipSource: "wan1"},
+		{host: domain.Hosts[1], ipv4: true, ipSource: "wan2"},
+		{host: domain.Hosts[2], ipv6: true, ipSource: "wan3"},
+		{host: domain.Hosts[3], ipv4: true, ipSource: "wan1"},
+	}
+
+	for _, test := range tests {
+		ipv4, ipv6, ipSource := domain.HostIPv4(test.host), domain.HostIPv6(test.host), domain.HostIPSource(test.host)
+		if ipv4 != test.ipv4 || ipv6 != test.ipv6 || ipSource != test.ipSource {
+			t.Errorf("host %s: IPV4 %t, IPV6 %t, IP-SOURCE %s, want %t, %t, %s",
+				test.host.Name, ipv4, ipv6, ipSource, test.ipv4, test.ipv6, test.ipSource)
+		}
+	}
+
+	if got := (&Domain{Hosts: []Host{{Name: "www"}}}).HostIPSource(Host{Name: "www"}); got != DefaultIPSource {
+		t.Errorf("HostIPSource() without any source = %s, want %s", got, DefaultIPSource)
+	}
+
+	var enabled []string
+	for _, host := range domain.EnabledHosts() {
+		enabled = append(enabled, host.Name)
+	}
+	if want := []string{"www", "mail", "vpn"}; !reflect.DeepEqual(enabled, want) {
+		t.Errorf("EnabledHosts() = %v, want %v", enabled, want)
+	}
+}
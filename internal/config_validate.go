@@ -0,0 +1,660 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	hostLabelRegex   = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?$`)
+	domainLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	typeErrorRegex   = regexp.MustCompile(`^line (\d+): `)
+)
+
+// Problem represents a single problem of a config.
+type Problem struct {
+	// Path is the path of the key the problem refers to, e.g.
+	// 'DOMAINS[0].TTL'.
+	Path string
+	// Position is where the key was set, e.g. 'config.yml:12' or
+	// 'environment variable DYNDNS_DOMAINS'. It is empty for keys that are
+	// not set at all.
+	Position string
+	Message  string
+}
+
+func (p Problem) String() string {
+	var prefix string
+	if p.Position != "" {
+		prefix = p.Position + ": "
+	}
+
+	if p.Path == "" {
+		return prefix + p.Message
+	}
+
+	return fmt.Sprintf("%s%s: %s", prefix, p.Path, p.Message)
+}
+
+// ValidationError is returned if a config has problems.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = "  " + problem.String()
+	}
+
+	return fmt.Sprintf("invalid config (%d problem(s)):\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// Validate checks the config and returns a ValidationError containing all
+// problems if there are any. Unknown keys and type errors found while
+// loading are reported as well.
+func (c *Config) Validate() error {
+	v := &validator{config: c, problems: append([]Problem(nil), c.problems...)}
+
+	v.validateAccounts()
+
+	if c.IPCacheTimeout < 0 {
+		v.report("IP-CACHE-TIMEOUT", "must not be negative")
+	}
+
+	switch c.IPCacheBackend {
+	case "", StateBackendFile, StateBackendMemory, StateBackendBolt:
+	default:
+		v.report("IP-CACHE-BACKEND", fmt.Sprintf("unknown backend '%s'%s", c.IPCacheBackend,
+			suggest(c.IPCacheBackend, []string{StateBackendFile, StateBackendMemory, StateBackendBolt})))
+	}
+
+	if c.VerifyRuns < 0 {
+		v.report("VERIFY-EVERY-RUNS", "must not be negative")
+	}
+
+	if c.VerifyInterval < 0 {
+		v.report("VERIFY-INTERVAL", "must not be negative")
+	}
+
+	for _, name := range sortedNames(c.IPSources) {
+		path := fmt.Sprintf("IP-SOURCES.%s", name)
+		if _, err := NewIPSource(c.IPSources[name]); err != nil {
+			v.report(path, err.Error())
+		}
+
+		v.validateBindOptions(path, c.IPSources[name])
+
+		if c.IPSources[name].Type == ipSourceStatic {
+			v.validateStaticAddr(path+".IPV4", c.IPSources[name].IPv4, false)
+			v.validateStaticAddr(path+".IPV6", c.IPSources[name].IPv6, true)
+		}
+	}
+
+	v.validateDefaults()
+
+	if len(c.Domains) == 0 {
+		v.report("DOMAINS", "at least one domain must be configured")
+	}
+
+	seen := make(map[string]int)
+	for i, domain := range c.Domains {
+		v.validateDomain(fmt.Sprintf("DOMAINS[%d]", i), domain)
+
+		name := strings.ToLower(domain.Name)
+		if first, ok := seen[name]; ok {
+			v.report(fmt.Sprintf("DOMAINS[%d].NAME", i), fmt.Sprintf("domain '%s' is already configured at DOMAINS[%d]%s",
+				domain.Name, first, inParens(c.position(fmt.Sprintf("DOMAINS[%d]", first)))))
+		} else {
+			seen[name] = i
+		}
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{v.problems}
+}
+
+type validator struct {
+	config   *Config
+	problems []Problem
+}
+
+// report adds a problem for a specified path. The position is the one of
+// the path or of its closest parent that has a position. Paths that already
+// have a problem from loading, e.g. a value of the wrong type, are skipped.
+func (v *validator) report(path, message string) {
+	for _, problem := range v.config.problems {
+		if problem.Path == path {
+			return
+		}
+	}
+
+	v.problems = append(v.problems, Problem{
+		Path:     path,
+		Position: v.config.position(path),
+		Message:  message,
+	})
+}
+
+// validateAccounts checks the credentials of all accounts. The top level
+// credentials are only required if they are used by a domain.
+func (v *validator) validateAccounts() {
+	c := v.config
+
+	_, configured := c.Accounts[DefaultAccount]
+	topLevel := c.CustomerNumber != 0 || c.APIKey != "" || c.APIPassword != ""
+	if configured && topLevel {
+		v.report("ACCOUNTS."+DefaultAccount, "the default account is also specified by the top level credentials")
+	}
+
+	if !configured && (topLevel || Contains(c.AccountNames(), DefaultAccount)) {
+		v.validateAccount("", Account{
+			CustomerNumber: c.CustomerNumber,
+			APIKey:         c.APIKey,
+			APIPassword:    c.APIPassword,
+		})
+	}
+
+	for _, name := range sortedNames(c.Accounts) {
+		v.validateAccount("ACCOUNTS."+name+".", c.Accounts[name])
+	}
+}
+
+func (v *validator) validateAccount(prefix string, account Account) {
+	if account.CustomerNumber <= 0 {
+		v.report(prefix+"CUSTOMERNR", "must be set to your netcup customer number")
+	}
+
+	if account.APIKey == "" {
+		v.report(prefix+"APIKEY", "must be set (or use APIKEY-FILE)")
+	}
+
+	if account.APIPassword == "" {
+		v.report(prefix+"APIPASSWORD", "must be set (or use APIPASSWORD-FILE)")
+	}
+}
+
+func (v *validator) validateDomain(path string, domain Domain) {
+	if !validDomainName(domain.Name) {
+		v.report(path+".NAME", fmt.Sprintf("'%s' is not a valid domain name", domain.Name))
+	}
+
+	// Inherited settings are reported where they are set in the DEFAULTS.
+	inherited := v.config.inherited(domain)
+
+	if domain.TTL <= 0 && !inherited["TTL"] {
+		v.report(path+".TTL", "must be greater than 0")
+	}
+
+	timers := map[string]int{"REFRESH": domain.Refresh, "RETRY": domain.Retry, "EXPIRE": domain.Expire}
+	for key := range timers {
+		if inherited[key] {
+			delete(timers, key)
+		}
+	}
+	v.validateTimers(path, timers)
+
+	if domain.Account != "" && !inherited["ACCOUNT"] {
+		v.validateAccountRef(path+".ACCOUNT", domain.Account)
+	}
+
+	if domain.IPSource != "" && !inherited["IP-SOURCE"] {
+		v.validateSourceRef(path+".IP-SOURCE", domain.IPSource)
+	}
+
+	if len(domain.Hosts) == 0 {
+		v.report(path+".HOSTS", "at least one host must be configured")
+	}
+
+	seen := make(map[string]bool)
+	for i, host := range domain.Hosts {
+		hostPath := fmt.Sprintf("%s.HOSTS[%d]", path, i)
+		v.validateHost(hostPath, domain, host)
+
+		if seen[strings.ToLower(host.Name)] {
+			v.report(hostPath, fmt.Sprintf("host '%s' is configured twice", host.Name))
+		}
+		seen[strings.ToLower(host.Name)] = true
+	}
+
+	for _, host := range sortedNames(domain.HostIPSources) {
+		hostPath := fmt.Sprintf("%s.HOST-IP-SOURCES.%s", path, host)
+		if !Contains(domain.HostNames(), host) {
+			v.report(hostPath, fmt.Sprintf("host '%s' is not in HOSTS", host))
+		}
+		v.validateSourceRef(hostPath, domain.HostIPSources[host])
+	}
+}
+
+// validateDefaults checks the settings of the Defaults.
+func (v *validator) validateDefaults() {
+	defaults := v.config.Defaults
+
+	if defaults.TTL < 0 {
+		v.report("DEFAULTS.TTL", "must not be negative")
+	}
+
+	v.validateTimers("DEFAULTS", map[string]int{"REFRESH": defaults.Refresh, "RETRY": defaults.Retry, "EXPIRE": defaults.Expire})
+
+	if defaults.Account != "" {
+		v.validateAccountRef("DEFAULTS.ACCOUNT", defaults.Account)
+	}
+
+	if defaults.IPSource != "" {
+		v.validateSourceRef("DEFAULTS.IP-SOURCE", defaults.IPSource)
+	}
+}
+
+func (v *validator) validateTimers(path string, timers map[string]int) {
+	for _, key := range sortedNames(timers) {
+		if timers[key] < 0 {
+			v.report(path+"."+key, "must not be negative")
+		}
+	}
+}
+
+// validateStaticAddr checks that the address of a static ip source belongs
+// to the right family.
+func (v *validator) validateStaticAddr(path, value string, ipv6 bool) {
+	if value == "" {
+		return
+	}
+
+	addr, err := netip.ParseAddr(value)
+	switch {
+	case err != nil:
+		v.report(path, fmt.Sprintf("'%s' is not an ip address", value))
+	case ipv6 && !addr.Is6():
+		v.report(path, fmt.Sprintf("'%s' is not an IPv6 address", value))
+	case !ipv6 && !addr.Is4():
+		v.report(path, fmt.Sprintf("'%s' is not an IPv4 address", value))
+	}
+}
+
+// validateBindOptions reports the bind options of ip sources that do not
+// make http requests and therefore cannot bind their connections.
+func (v *validator) validateBindOptions(path string, source IPSourceConfig) {
+	switch source.Type {
+	case ipSourceStatic, ipSourceExec, ipSourceMeta:
+	default:
+		return
+	}
+
+	for _, option := range []struct{ key, value string }{
+		{"INTERFACE", source.Interface},
+		{"SOURCE-IPV4", source.SourceIPv4},
+		{"SOURCE-IPV6", source.SourceIPv6},
+	} {
+		if option.value != "" {
+			v.report(path+"."+option.key, fmt.Sprintf("is only supported by ip sources of type ipify and http, not %s", source.Type))
+		}
+	}
+}
+
+func (v *validator) validateAccountRef(path, name string) {
+	if _, ok := v.config.Account(name); !ok {
+		names := append(sortedNames(v.config.Accounts), DefaultAccount)
+		v.report(path, fmt.Sprintf("unknown account '%s'%s", name, suggest(name, names)))
+	}
+}
+
+func (v *validator) validateHost(path string, domain Domain, host Host) {
+	if host.Name == "" {
+		v.report(path+".NAME", "must be set")
+	} else if problem := hostProblem(host.Name, domain.Name); problem != "" {
+		v.report(path, problem)
+	}
+
+	if host.IPSource != "" {
+		v.validateSourceRef(path+".IP-SOURCE", host.IPSource)
+	}
+
+	if host.IsEnabled() && !domain.HostIPv4(host) && !domain.HostIPv6(host) {
+		v.report(path, fmt.Sprintf("neither IPV4 nor IPV6 is enabled for host '%s'", host.Name))
+	}
+}
+
+func (v *validator) validateSourceRef(path, name string) {
+	if name == DefaultIPSource {
+		return
+	}
+
+	if _, ok := v.config.IPSources[name]; !ok {
+		names := append(sortedNames(v.config.IPSources), DefaultIPSource)
+		v.report(path, fmt.Sprintf("unknown ip source '%s'%s", name, suggest(name, names)))
+	}
+}
+
+// CheckHost returns an error if a host is not valid for a domain, e.g.
+// because it is written as fully qualified name.
+func CheckHost(host, domain string) error {
+	if problem := hostProblem(host, domain); problem != "" {
+		return errors.New(problem)
+	}
+
+	return nil
+}
+
+// hostProblem returns what is wrong with a host of a domain or an empty
+// string if the host is valid.
+func hostProblem(host, domain string) string {
+	if host == "@" || host == "*" {
+		return ""
+	}
+
+	lower := strings.ToLower(host)
+	if domain != "" && (lower == strings.ToLower(domain) || strings.HasSuffix(lower, "."+strings.ToLower(domain))) {
+		short := strings.TrimSuffix(strings.TrimSuffix(lower, strings.ToLower(domain)), ".")
+		if short == "" {
+			short = "@"
+		}
+		return fmt.Sprintf("hosts are relative to the domain, use '%s' instead of '%s'", short, host)
+	}
+
+	if strings.HasSuffix(host, ".") {
+		return fmt.Sprintf("hosts are relative to the domain, '%s' must not end with a dot", host)
+	}
+
+	for i, label := range strings.Split(host, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if !hostLabelRegex.MatchString(label) {
+			return fmt.Sprintf("'%s' is not a valid host name", host)
+		}
+	}
+
+	return ""
+}
+
+func validDomainName(name string) bool {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) < 2 || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range labels {
+		if !domainLabelRegex.MatchString(label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// inParens describes a position in a message. It is empty if the position is
+// unknown.
+func inParens(position string) string {
+	if position == "" {
+		return ""
+	}
+
+	return " (" + position + ")"
+}
+
+// position returns the position of a path or of its closest parent.
+func (c *Config) position(path string) string {
+	for path != "" {
+		if position, ok := c.positions[path]; ok {
+			return position
+		}
+
+		index := strings.LastIndexAny(path, ".[")
+		if index < 0 {
+			break
+		}
+		path = path[:index]
+	}
+
+	return ""
+}
+
+// pathAt returns the deepest path that was set at a position.
+func (c *Config) pathAt(position string) string {
+	var deepest string
+	for path, pathPosition := range c.positions {
+		if pathPosition == position && (len(path) > len(deepest) || (len(path) == len(deepest) && path < deepest)) {
+			deepest = path
+		}
+	}
+
+	return deepest
+}
+
+// setPosition records where a path was set. The positions of its children
+// are removed because the new value replaces them.
+func (c *Config) setPosition(path, position string) {
+	if c.positions == nil {
+		c.positions = make(map[string]string)
+	}
+
+	for key := range c.positions {
+		if strings.HasPrefix(key, path+".") || strings.HasPrefix(key, path+"[") {
+			delete(c.positions, key)
+		}
+	}
+
+	c.positions[path] = position
+}
+
+// nodeWalker walks a YAML document along the type it is decoded into. It
+// records the position of every key and reports unknown keys.
+type nodeWalker struct {
+	config   *Config
+	filename string
+}
+
+func (w *nodeWalker) walk(node *yaml.Node, t reflect.Type, path string, line int) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		for _, content := range node.Content {
+			w.walk(content, t, path, content.Line)
+		}
+		return
+	}
+
+	if path != "" {
+		w.config.setPosition(path, w.position(line))
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" || (path == "" && key.Value == schemaKey) {
+				continue
+			}
+
+			field, ok := structFieldByExactKey(t, key.Value)
+			if !ok {
+				w.config.problems = append(w.config.problems, Problem{
+					Path:     joinPath(path, key.Value),
+					Position: w.position(key.Line),
+					Message:  "unknown key" + suggest(key.Value, structKeys(t)),
+				})
+				continue
+			}
+
+			w.walk(value, field.Type, joinPath(path, key.Value), key.Line)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			w.walk(value, t.Elem(), joinPath(path, key.Value), key.Line)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			w.walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), item.Line)
+		}
+	}
+}
+
+// position returns the position of a line in the file. Documents that were
+// converted from other formats have no line numbers.
+func (w *nodeWalker) position(line int) string {
+	if line <= 0 {
+		return w.filename
+	}
+
+	return fmt.Sprintf("%s:%d", w.filename, line)
+}
+
+// decode decodes a document into the config. Type errors are recorded as
+// problems, so the other problems of the config are reported as well.
+func (w *nodeWalker) decode(document *yaml.Node) error {
+	var typeErr *yaml.TypeError
+	err := document.Decode(w.config)
+	if err != nil && !errors.As(err, &typeErr) {
+		return fmt.Errorf("%s: %w", w.filename, err)
+	}
+
+	typeErr = joinTypeErrors(typeErr, w.config.takeTypeErrors())
+	if typeErr != nil {
+		w.config.problems = append(w.config.problems, w.typeErrorProblems(typeErr)...)
+	}
+
+	return nil
+}
+
+// typeErrorProblems converts the errors of a yaml.TypeError to problems.
+// The path of a problem is the deepest path set on the line of the error.
+func (w *nodeWalker) typeErrorProblems(err *yaml.TypeError) []Problem {
+	problems := make([]Problem, len(err.Errors))
+	for i, message := range err.Errors {
+		var path string
+		position := w.filename
+		if match := typeErrorRegex.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			position = w.position(line)
+			message = message[len(match[0]):]
+			if line > 0 {
+				path = w.config.pathAt(position)
+			}
+		}
+		problems[i] = Problem{Path: path, Position: position, Message: message}
+	}
+
+	return problems
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// structFieldByExactKey returns the field of a struct type with a specified
+// key. Like the YAML decoder it matches the key case sensitive.
+func structFieldByExactKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if yamlKey(field) == key && key != "" {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func structKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		if key := yamlKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// suggest returns a "did you mean" hint for the candidate that is most
+// similar to a specified value or an empty string if none is similar
+// enough. A candidate is similar if its edit distance is small or if it
+// is a prefix of the value like 'IP-CACHE' of 'IP-CACHE-LOCATION'.
+func suggest(value string, candidates []string) string {
+	upper := strings.ToUpper(value)
+
+	best, bestDistance := "", len(upper)/3+2
+	for _, candidate := range candidates {
+		distance := levenshtein(upper, strings.ToUpper(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	if best == "" {
+		for _, candidate := range candidates {
+			if strings.HasPrefix(upper, strings.ToUpper(candidate)+"-") && len(candidate) > len(best) {
+				best = candidate
+			}
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean '%s'?", best)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// envPosition returns the position of a key set by an environment variable.
+func envPosition(name string) string {
+	return "environment variable " + name
+}
+
+// overridePosition returns the position of a key set by the -set flag.
+func overridePosition(key string) string {
+	return "flag -set " + strconv.Quote(key)
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateProblems(t *testing.T) {
+	const account = "CUSTOMERNR: 1\nAPIKEY: key\nAPIPASSWORD: password\n"
+
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "valid",
+			config: account + "DOMAINS:\n  - NAME: example.de\n    TTL: 300\n    HOSTS: [\"@\", www]\n",
+		},
+		{
+			name:   "no domains",
+			config: account,
+			want:   []string{"DOMAINS: at least one domain must be configured"},
+		},
+		{
+			name:   "unknown key",
+			config: account + "IP-CACHE-TIMOUT: 30\nDOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+			want:   []string{"config.yml:4: IP-CACHE-TIMOUT: unknown key, did you mean 'IP-CACHE-TIMEOUT'?"},
+		},
+		{
+			name: "type error keeps the domain",
+			config: account + "DOMAINS:\n" +
+				"  - NAME: example.de\n" +
+				"    TTL: five\n" +
+				"    HOSTS: [www]\n" +
+				"  - NAME: example.de\n" +
+				"    TTL: 300\n" +
+				"    HOSTS: [www]\n",
+			want: []string{
+				"config.yml:6: DOMAINS[0].TTL: cannot unmarshal !!str `five` into int",
+				"config.yml:8: DOMAINS[1].NAME: domain 'example.de' is already configured at DOMAINS[0] (config.yml:5)",
+			},
+		},
+		{
+			name: "static addresses",
+			config: account +
+				"IP-SOURCES:\n" +
+				"  fixed:\n" +
+				"    TYPE: static\n" +
+				"    IPV4: 2001:db8::1\n" +
+				"    IPV6: localhost\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www], IP-SOURCE: fixed}]\n",
+			want: []string{
+				"config.yml:7: IP-SOURCES.fixed.IPV4: '2001:db8::1' is not an IPv4 address",
+				"config.yml:8: IP-SOURCES.fixed.IPV6: 'localhost' is not an ip address",
+			},
+		},
+		{
+			name: "bind options of a metadata source",
+			config: account +
+				"IP-SOURCES:\n" +
+				"  cloud:\n" +
+				"    TYPE: metadata\n" +
+				"    PROVIDER: ec2\n" +
+				"    INTERFACE: eth1\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www], IP-SOURCE: cloud}]\n",
+			want: []string{
+				"config.yml:8: IP-SOURCES.cloud.INTERFACE: is only supported by ip sources of type ipify and http, not metadata",
+			},
+		},
+		{
+			name: "named accounts only",
+			config: "ACCOUNTS:\n" +
+				"  work: {CUSTOMERNR: 2, APIKEY: key, APIPASSWORD: password}\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www], ACCOUNT: work}]\n",
+		},
+		{
+			name: "unknown account",
+			config: account +
+				"ACCOUNTS:\n" +
+				"  work: {CUSTOMERNR: 2, APIKEY: key, APIPASSWORD: password}\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www], ACCOUNT: wrok}]\n",
+			want: []string{"config.yml:6: DOMAINS[0].ACCOUNT: unknown account 'wrok', did you mean 'work'?"},
+		},
+		{
+			name: "unknown default account",
+			config: account +
+				"DEFAULTS: {ACCOUNT: work}\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+			want: []string{"config.yml:4: DEFAULTS.ACCOUNT: unknown account 'work'"},
+		},
+		{
+			name:   "top level credentials used by a domain",
+			config: "CUSTOMERNR: 1\nDOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+			want: []string{
+				"APIKEY: must be set (or use APIKEY-FILE)",
+				"APIPASSWORD: must be set (or use APIPASSWORD-FILE)",
+			},
+		},
+		{
+			name: "incomplete named account",
+			config: "ACCOUNTS:\n" +
+				"  work: {APIKEY: key}\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www], ACCOUNT: work}]\n",
+			want: []string{
+				"config.yml:2: ACCOUNTS.work.CUSTOMERNR: must be set to your netcup customer number",
+				"config.yml:2: ACCOUNTS.work.APIPASSWORD: must be set (or use APIPASSWORD-FILE)",
+			},
+		},
+		{
+			name: "default account twice",
+			config: account +
+				"ACCOUNTS:\n" +
+				"  default: {CUSTOMERNR: 2, APIKEY: key, APIPASSWORD: password}\n" +
+				"DOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n",
+			want: []string{"config.yml:5: ACCOUNTS.default: the default account is also specified by the top level credentials"},
+		},
+		{
+			name:   "unknown ip source",
+			config: account + "DOMAINS:\n  - NAME: example.de\n    TTL: 300\n    IP-SOURCE: wan\n    HOSTS: [www]\n",
+			want:   []string{"config.yml:7: DOMAINS[0].IP-SOURCE: unknown ip source 'wan'"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.yml")
+			writeTestFile(t, file, test.config)
+
+			_, err := (&ConfigLoader{File: file}).Load()
+			if test.want == nil {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Load() error = %v, want a ValidationError", err)
+			}
+
+			assertProblems(t, validationErr, dir, test.want)
+		})
+	}
+}
+
+func TestConfigLoaderUnknownEnv(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	writeTestFile(t, file, "CUSTOMERNR: 1\nAPIKEY: key\nAPIPASSWORD: password\nDOMAINS: [{NAME: example.de, TTL: 300, HOSTS: [www]}]\n")
+
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	loader := &ConfigLoader{
+		File:   file,
+		Env:    []string{"DYNDNS_IP_CAHCE_TIMEOUT=30", familyEnv + "=ipv4"},
+		Logger: NewLogger(false),
+	}
+
+	// Unknown variables are only warned about.
+	if _, err := loader.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := "[Warning]: environment variable DYNDNS_IP_CAHCE_TIMEOUT: unknown key, did you mean 'DYNDNS_IP_CACHE_TIMEOUT'?"
+	if output := buf.String(); !strings.Contains(output, want) || strings.Count(output, "[Warning]") != 1 {
+		t.Errorf("output = %q, want the warning %q", output, want)
+	}
+}
+
+// assertProblems compares the problems of a ValidationError with the
+// expected output. The directory of the config files is removed from the
+// positions.
+func assertProblems(t *testing.T, err *ValidationError, dir string, want []string) {
+	t.Helper()
+
+	var got []string
+	for _, problem := range err.Problems {
+		got = append(got, strings.ReplaceAll(problem.String(), dir+string(filepath.Separator), ""))
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("problems = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("problem %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
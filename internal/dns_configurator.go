@@ -1,148 +1,391 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
 )
 
+// dnsClient is the part of the netcup api that is used to configure the
+// records. It is implemented by *netcup.Client.
+type dnsClient interface {
+	Login() error
+	InfoDNSZone(domainname string) (*netcup.DNSZone, error)
+	InfoDNSRecords(domainname string) (*netcup.DNSRecordSet, error)
+	UpdateDNSZone(domainname string, dnszone *netcup.DNSZone) error
+	UpdateDNSRecords(domainname string, dnsRecordSet *netcup.DNSRecordSet) error
+}
+
 // DNSConfiguratorService represents a service that will update the
-// DNS records for a given netcup account
+// DNS records for the configured netcup accounts
 type DNSConfiguratorService struct {
-	config *Config
-	client *netcup.Client
-	cache  *Cache
-	logger *Logger
+	config    *Config
+	clients   map[string]dnsClient
+	newClient func(Account) dnsClient
+	cache     *Cache
+	logger    *Logger
+	addrInfo  *AddrInfo
+	failures  *RunError
+	verify    bool
+	// failed counts the calls of fail including repeated failures and
+	// configured the records that were configured or found up to date.
+	failed     int
+	configured int
 }
 
 // NewDNSConfigurator returns a DNSConfiguratorService by given config, cache and logger
 func NewDNSConfigurator(config *Config, cache *Cache, logger *Logger) *DNSConfiguratorService {
 	return &DNSConfiguratorService{
-		config: config,
-		cache:  cache,
-		logger: logger,
+		config:    config,
+		clients:   make(map[string]dnsClient),
+		newClient: func(account Account) dnsClient { return account.NewClient() },
+		cache:     cache,
+		logger:    logger,
 	}
 }
 
-// Configure will configure the DNS Zones and Records in a netcup account as specified by
-// the config
-func (dnsc *DNSConfiguratorService) Configure() {
-	dnsc.login()
+// SetConfig replaces the config for the following runs. The config should
+// be validated before. The clients are recreated because the accounts may
+// have changed.
+func (dnsc *DNSConfiguratorService) SetConfig(config *Config) {
+	dnsc.config = config
+	dnsc.clients = make(map[string]dnsClient)
+}
+
+// SetAddrInfo overrides the detection of the public ip addresses with the
+// specified ones. Only the families that are set in addrInfo will be configured.
+func (dnsc *DNSConfiguratorService) SetAddrInfo(addrInfo *AddrInfo) {
+	dnsc.addrInfo = addrInfo
+}
+
+// Configure will configure the DNS Zones and Records in the netcup accounts as specified by
+// the config. Every account, domain and address family is processed independently. If
+// some of them fail, the remaining ones are configured anyway and a *RunError
+// containing all failures is returned. Any other error means that nothing
+// could be configured, e.g. because every address lookup failed.
+func (dnsc *DNSConfiguratorService) Configure() error {
+	resolver, err := NewAddrResolver(dnsc.config.IPSources)
+	if err != nil {
+		return err
+	}
 
-	ipAddresses, err := GetAddrInfo(dnsc.config.IPv4Enabled(), dnsc.config.IPv6Enabled())
+	loginErrs, err := dnsc.login()
 	if err != nil {
-		dnsc.logger.Error(err)
+		return err
 	}
 
-	dnsc.configureDomains(ipAddresses.IPv4, ipAddresses.IPv6)
+	started := time.Now()
+	dnsc.failures = &RunError{}
+	dnsc.failed, dnsc.configured = 0, 0
+	for _, err := range loginErrs {
+		dnsc.fail(err)
+	}
+	dnsc.verify = dnsc.verificationDue()
+	if dnsc.verify {
+		dnsc.logger.Info("Verifying all records at netcup, ignoring the cache")
+	}
+
+	dnsc.configureDomains(resolver)
+
+	if dnsc.cache != nil {
+		if dnsc.verify && len(dnsc.failures.Errors) == 0 {
+			dnsc.cache.Verified()
+		}
+		dnsc.cache.SetLastRun(dnsc.runResult(started))
 
-	if dnsc.config.CacheEnabled() {
 		err := dnsc.cache.Store()
 		if err != nil {
-			dnsc.logger.Error(err)
+			dnsc.fail(fmt.Errorf("storing cache: %w", err))
 		}
 	}
+
+	if dnsc.configured == 0 && len(dnsc.failures.Errors) > 0 {
+		return fmt.Errorf("no record could be configured: %w", errors.Join(dnsc.failures.Errors...))
+	}
+
+	return dnsc.failures.errorOrNil()
 }
 
-func (dnsc *DNSConfiguratorService) login() {
-	dnsc.client = netcup.NewClient(dnsc.config.CustomerNumber, dnsc.config.APIKey, dnsc.config.APIPassword)
-	err := dnsc.client.Login()
-	if err != nil {
-		dnsc.logger.Error(err)
+// verificationDue returns true if the cache should be bypassed in this run
+// as specified by the verification policy of the config.
+func (dnsc *DNSConfiguratorService) verificationDue() bool {
+	if dnsc.cache == nil || !dnsc.config.VerifyEnabled() {
+		return false
+	}
+
+	interval := time.Duration(dnsc.config.VerifyInterval) * time.Second
+	return dnsc.cache.VerificationDue(dnsc.config.VerifyRuns, interval)
+}
+
+func (dnsc *DNSConfiguratorService) runResult(started time.Time) RunResult {
+	result := RunResult{
+		Started:  started,
+		Finished: time.Now(),
 	}
+
+	for _, err := range dnsc.failures.Errors {
+		result.Failures = append(result.Failures, err.Error())
+	}
+
+	return result
 }
 
-func (dnsc *DNSConfiguratorService) configureDomains(ipv4, ipv6 string) {
+// login logs in to every account that is used by a domain. It returns the
+// login errors of the accounts that failed. If no account could be logged in
+// the error is returned as second value instead.
+func (dnsc *DNSConfiguratorService) login() ([]error, error) {
+	var errs []error
+	for _, name := range dnsc.config.AccountNames() {
+		client, ok := dnsc.clients[name]
+		if !ok {
+			account, _ := dnsc.config.Account(name)
+			client = dnsc.newClient(account)
+			dnsc.clients[name] = client
+		}
+
+		if err := client.Login(); err != nil {
+			if len(dnsc.config.Accounts) > 0 {
+				err = fmt.Errorf("account %s: login: %w", name, err)
+			}
+			errs = append(errs, err)
+			delete(dnsc.clients, name)
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(dnsc.config.AccountNames()) {
+		return nil, errors.Join(errs...)
+	}
+
+	return errs, nil
+}
+
+// fail reports a failure that affects only a part of the run.
+// A failure that was already reported in this run is not logged again.
+func (dnsc *DNSConfiguratorService) fail(err error) {
+	dnsc.failed++
+	if dnsc.failures.add(err) {
+		dnsc.logger.Warning("%v", err)
+	}
+}
+
+func (dnsc *DNSConfiguratorService) configureDomains(resolver *AddrResolver) {
 	for _, domain := range dnsc.config.Domains {
-		if dnsc.needsUpdate(domain, ipv4, ipv6) {
-			dnsc.configureZone(domain)
-			dnsc.configureRecords(domain, ipv4, ipv6)
+		client, ok := dnsc.clients[domain.AccountName()]
+		if !ok {
+			dnsc.logger.Info("Skipping domain %s because the login to account %s failed", domain.Name, domain.AccountName())
+			continue
+		}
+
+		dnsc.checkFingerprint(domain)
+
+		addrs := dnsc.hostAddrs(domain, resolver)
+		failed := dnsc.failed
+		if dnsc.needsUpdate(domain, addrs) {
+			zone := dnsc.configureZone(client, domain)
+			dnsc.configureRecords(client, domain, zone, addrs)
+		}
+
+		if dnsc.failed == failed {
+			dnsc.configured += resolvedRecords(domain, addrs)
+		}
+	}
+}
+
+// resolvedRecords returns the number of records of a domain whose address
+// is known.
+func resolvedRecords(domain Domain, addrs map[string]*AddrInfo) int {
+	count := 0
+	for _, host := range domain.EnabledHosts() {
+		if domain.HostIPv4(host) && addrs[host.Name].IPv4 != "" {
+			count++
+		}
+		if domain.HostIPv6(host) && addrs[host.Name].IPv6 != "" {
+			count++
 		}
 	}
 
+	return count
 }
 
-func (dnsc *DNSConfiguratorService) needsUpdate(domain Domain, ipv4, ipv6 string) bool {
+// checkFingerprint invalidates the cache entries of a domain if its config
+// changed since the entries were created.
+func (dnsc *DNSConfiguratorService) checkFingerprint(domain Domain) {
 	if dnsc.cache == nil {
+		return
+	}
+
+	fingerprint, err := dnsc.config.Fingerprint(domain)
+	if err != nil {
+		dnsc.logger.Warning("Unable to detect config changes of domain %s: %s", domain.Name, err)
+		return
+	}
+
+	if !dnsc.cache.CheckFingerprint(domain.Name, fingerprint) {
+		dnsc.logger.Info("Config of domain %s changed. Invalidating its cache entries", domain.Name)
+	}
+}
+
+// hostAddrs returns the addresses for every host of a domain. The addresses
+// are either the ones set with SetAddrInfo or resolved from the ip source of
+// the host.
+func (dnsc *DNSConfiguratorService) hostAddrs(domain Domain, resolver *AddrResolver) map[string]*AddrInfo {
+	addrs := make(map[string]*AddrInfo)
+	for _, host := range domain.EnabledHosts() {
+		if dnsc.addrInfo != nil {
+			addrs[host.Name] = dnsc.addrInfo
+			continue
+		}
+
+		var err error
+		addrInfo := &AddrInfo{}
+		source := domain.HostIPSource(host)
+
+		if domain.HostIPv4(host) {
+			addrInfo.IPv4, err = resolver.IPv4(source)
+			if err != nil {
+				dnsc.fail(err)
+			}
+		}
+
+		if domain.HostIPv6(host) {
+			addrInfo.IPv6, err = resolver.IPv6(source)
+			if err != nil {
+				dnsc.fail(err)
+			}
+		}
+
+		addrs[host.Name] = addrInfo
+	}
+
+	return addrs
+}
+
+func (dnsc *DNSConfiguratorService) needsUpdate(domain Domain, addrs map[string]*AddrInfo) bool {
+	if dnsc.cache == nil || dnsc.verify {
 		return true
 	}
 
 	update := false
 
-	for _, host := range domain.Hosts {
-		if domain.IPv4 {
-			hostIPv4 := dnsc.cache.GetIPv4(domain.Name, host)
-			if hostIPv4 == "" || hostIPv4 != ipv4 {
-				dnsc.cache.SetIPv4(domain.Name, host, ipv4)
+	for _, host := range domain.EnabledHosts() {
+		ipv4, ipv6 := addrs[host.Name].IPv4, addrs[host.Name].IPv6
+
+		if domain.HostIPv4(host) && ipv4 != "" {
+			entry := dnsc.cache.Get(domain.Name, host.Name, "A")
+			if (entry == nil || entry.Value != ipv4) && !dnsc.cache.IsSkipped(domain.Name, host.Name, "A", ipv4) {
 				update = true
 			}
 		}
 
-		if domain.IPv6 {
-			hostIPv6 := dnsc.cache.GetIPv6(domain.Name, host)
-			if hostIPv6 == "" || hostIPv6 != ipv6 {
-				dnsc.cache.SetIPv6(domain.Name, host, ipv6)
+		if domain.HostIPv6(host) && ipv6 != "" {
+			entry := dnsc.cache.Get(domain.Name, host.Name, "AAAA")
+			if (entry == nil || entry.Value != ipv6) && !dnsc.cache.IsSkipped(domain.Name, host.Name, "AAAA", ipv6) {
 				update = true
 			}
 		}
 
 		if !update {
-			dnsc.logger.Info("Host %s is in ipCache and needs no update", host)
+			dnsc.logger.Info("Host %s is in ipCache and needs no update", host.Name)
 		}
 	}
 
 	return update
 }
 
-func (dnsc *DNSConfiguratorService) configureZone(domain Domain) {
+// configureZone updates the TTL and the SOA timers of the zone of a domain
+// if necessary. It returns the zone or nil if it could not be loaded.
+func (dnsc *DNSConfiguratorService) configureZone(client dnsClient, domain Domain) *netcup.DNSZone {
 	dnsc.logger.Info("Loading DNS Zone info for domain %s", domain.Name)
-	zone, err := dnsc.client.InfoDNSZone(domain.Name)
+	zone, err := client.InfoDNSZone(domain.Name)
 	if err != nil {
-		dnsc.logger.Error(err)
+		dnsc.fail(fmt.Errorf("domain %s: loading zone: %w", domain.Name, err))
+		return nil
 	}
 
-	zoneTTL, err := strconv.Atoi(zone.TTL)
-	if err != nil {
-		dnsc.logger.Error(err)
-	}
+	// Timers that are not configured are left unchanged.
+	needsUpdate := false
+	for _, timer := range []struct {
+		name  string
+		value *string
+		want  int
+	}{
+		{"TTL", &zone.TTL, domain.TTL},
+		{"Refresh", &zone.Refresh, domain.Refresh},
+		{"Retry", &zone.Retry, domain.Retry},
+		{"Expire", &zone.Expire, domain.Expire},
+	} {
+		if timer.want <= 0 {
+			continue
+		}
 
-	if zoneTTL != domain.TTL {
-		dnsc.logger.Info("TTL for %s is %d but should be %d. Updating...", domain.Name, zoneTTL, domain.TTL)
+		current, err := strconv.Atoi(*timer.value)
+		if err != nil {
+			dnsc.fail(fmt.Errorf("domain %s: parsing zone %s: %w", domain.Name, timer.name, err))
+			return zone
+		}
 
-		zone.TTL = strconv.Itoa(domain.TTL)
-		err = dnsc.client.UpdateDNSZone(domain.Name, zone)
+		if current != timer.want {
+			dnsc.logger.Info("%s for %s is %d but should be %d. Updating...", timer.name, domain.Name, current, timer.want)
+			*timer.value = strconv.Itoa(timer.want)
+			needsUpdate = true
+		}
+	}
+
+	if needsUpdate {
+		err = client.UpdateDNSZone(domain.Name, zone)
 		if err != nil {
-			dnsc.logger.Error(err)
+			dnsc.fail(fmt.Errorf("domain %s: updating zone: %w", domain.Name, err))
 		}
 	}
+
+	return zone
 }
 
-func (dnsc *DNSConfiguratorService) configureRecords(domain Domain, ipv4, ipv6 string) {
-	dnsc.logger.Info("Loading DNS Records for domain %s", domain.Name)
-	records, err := dnsc.client.InfoDNSRecords(domain.Name)
+func (dnsc *DNSConfiguratorService) configureRecords(client dnsClient, domain Domain, zone *netcup.DNSZone, addrs map[string]*AddrInfo) {
+	records, err := dnsc.loadRecords(client, domain, zone)
 	if err != nil {
-		dnsc.logger.Error(err)
+		dnsc.fail(fmt.Errorf("domain %s: loading records: %w", domain.Name, err))
+		return
 	}
 
+	dnsc.reportDrift(domain, records)
+
 	var updateRecords []netcup.DNSRecord
-	for _, host := range domain.Hosts {
-		if domain.IPv4 {
-			if records.GetRecordOccurences(host, "A") > 1 {
-				dnsc.logger.Info("Too many A records for host '%s'. Please specify only Hosts with one corresponding A record", host)
+	for _, host := range domain.EnabledHosts() {
+		ipv4, ipv6 := addrs[host.Name].IPv4, addrs[host.Name].IPv6
+
+		if domain.HostIPv4(host) && ipv4 != "" {
+			if records.GetRecordOccurences(host.Name, "A") > 1 {
+				dnsc.logger.Info("Too many A records for host '%s'. Please specify only Hosts with one corresponding A record", host.Name)
+				dnsc.skip(domain.Name, host.Name, "A", ipv4)
+			} else if dnsc.skipMissing(domain, host.Name, "A", ipv4, records) {
+				dnsc.skip(domain.Name, host.Name, "A", ipv4)
 			} else {
-				newRecord, needsUpdate := dnsc.configureARecord(host, ipv4, records)
+				newRecord, needsUpdate := dnsc.configureARecord(host.Name, ipv4, records)
 				if needsUpdate {
 					updateRecords = append(updateRecords, *newRecord)
+					dnsc.stage(domain.Name, newRecord, ipv4)
+				} else {
+					dnsc.verified(domain.Name, host.Name, "A", ipv4, records)
 				}
 			}
 		}
-		if domain.IPv6 {
-			if records.GetRecordOccurences(host, "AAAA") > 1 {
-				dnsc.logger.Info("Too many AAAA records for host '%s'. Please specify only Hosts with one corresponding AAAA record", host)
+		if domain.HostIPv6(host) && ipv6 != "" {
+			if records.GetRecordOccurences(host.Name, "AAAA") > 1 {
+				dnsc.logger.Info("Too many AAAA records for host '%s'. Please specify only Hosts with one corresponding AAAA record", host.Name)
+				dnsc.skip(domain.Name, host.Name, "AAAA", ipv6)
+			} else if dnsc.skipMissing(domain, host.Name, "AAAA", ipv6, records) {
+				dnsc.skip(domain.Name, host.Name, "AAAA", ipv6)
 			} else {
-				newRecord, needsUpdate := dnsc.configureAAAARecord(host, ipv6, records)
+				newRecord, needsUpdate := dnsc.configureAAAARecord(host.Name, ipv6, records)
 				if needsUpdate {
 					updateRecords = append(updateRecords, *newRecord)
+					dnsc.stage(domain.Name, newRecord, ipv6)
+				} else {
+					dnsc.verified(domain.Name, host.Name, "AAAA", ipv6, records)
 				}
 			}
 		}
@@ -151,16 +394,165 @@ func (dnsc *DNSConfiguratorService) configureRecords(domain Domain, ipv4, ipv6 s
 	if len(updateRecords) > 0 {
 		dnsc.logger.Info("Performing update on all queued records")
 		updateRecordSet := netcup.NewDNSRecordSet(updateRecords)
-		err = dnsc.client.UpdateDNSRecords(domain.Name, updateRecordSet)
+		err = client.UpdateDNSRecords(domain.Name, updateRecordSet)
 		if err != nil {
-			dnsc.logger.Error(err)
+			dnsc.fail(fmt.Errorf("domain %s: updating records: %w", domain.Name, err))
+			dnsc.discard(domain.Name)
+		} else {
+			dnsc.commit(domain.Name)
 		}
+
+		// The snapshot is outdated now. The next run has to fetch the records.
+		dnsc.dropSnapshot(domain.Name)
 	} else {
 		dnsc.logger.Info("No updates queued.")
 	}
 }
 
+// skip remembers that a record was skipped, so it is not loaded from netcup
+// and reported again until the cache timeout expires.
+func (dnsc *DNSConfiguratorService) skip(domain, host, dnstype, value string) {
+	if dnsc.cache != nil {
+		dnsc.cache.Skip(domain, host, dnstype, value)
+	}
+}
+
+// skipMissing returns whether a record is skipped because it does not exist
+// and the domain does not create missing records.
+func (dnsc *DNSConfiguratorService) skipMissing(domain Domain, host, dnstype, address string, records *netcup.DNSRecordSet) bool {
+	if !domain.SkipMissing || address == RemoveAddress || records.GetRecord(host, dnstype) != nil {
+		return false
+	}
+
+	dnsc.logger.Info("There is no %s record for '%s'. Skipping because SKIP-MISSING is set", dnstype, host)
+	return true
+}
+
+// reportDrift warns about every configured record whose value at netcup
+// differs from the cached value. Such records were changed outside of
+// dyndns-netcup-go and are repaired by this run. Records of disabled hosts
+// and of families a host does not configure are not repaired and therefore
+// not reported.
+func (dnsc *DNSConfiguratorService) reportDrift(domain Domain, records *netcup.DNSRecordSet) {
+	if dnsc.cache == nil {
+		return
+	}
+
+	for _, drift := range FindDrift(domain.Name, dnsc.cache.Entries(), records) {
+		if !configuresRecord(domain, drift.Entry.Host, drift.Entry.Type) {
+			continue
+		}
+
+		dnsc.logger.Warning("Drift detected for %s record of '%s': cached %s but netcup has %s. Repairing...",
+			drift.Entry.Type, drift.Entry.FQDN(), drift.Entry.Value, drift.Remote)
+	}
+}
+
+// configuresRecord returns whether a record of a specified host and type is
+// configured by this run.
+func configuresRecord(domain Domain, name, dnstype string) bool {
+	for _, host := range domain.EnabledHosts() {
+		if host.Name != name {
+			continue
+		}
+
+		switch dnstype {
+		case "A":
+			return domain.HostIPv4(host)
+		case "AAAA":
+			return domain.HostIPv6(host)
+		}
+	}
+
+	return false
+}
+
+// loadRecords returns the records of a domain. If the serial of the zone did
+// not change since the records were last fetched, the records of the zone
+// snapshot are used instead of fetching them again. During a verification
+// the records are always fetched.
+func (dnsc *DNSConfiguratorService) loadRecords(client dnsClient, domain Domain, zone *netcup.DNSZone) (*netcup.DNSRecordSet, error) {
+	if dnsc.cache != nil && !dnsc.verify && zone != nil && zone.Serial != "" {
+		snapshot := dnsc.cache.Zone(domain.Name)
+		if snapshot != nil && snapshot.Serial == zone.Serial {
+			dnsc.logger.Info("Serial of zone %s is unchanged. Using cached DNS Records", domain.Name)
+			return netcup.NewDNSRecordSet(append([]netcup.DNSRecord(nil), snapshot.Records...)), nil
+		}
+	}
+
+	dnsc.logger.Info("Loading DNS Records for domain %s", domain.Name)
+	records, err := client.InfoDNSRecords(domain.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsc.snapshot(domain.Name, zone, records)
+	return records, nil
+}
+
+// snapshot stores the records of a zone in the cache.
+func (dnsc *DNSConfiguratorService) snapshot(domain string, zone *netcup.DNSZone, records *netcup.DNSRecordSet) {
+	if dnsc.cache == nil {
+		return
+	}
+
+	var serial string
+	if zone != nil {
+		serial = zone.Serial
+	}
+
+	dnsc.cache.SetZone(domain, ZoneSnapshot{
+		Serial:  serial,
+		Records: records.DNSRecords,
+		Fetched: time.Now(),
+	})
+}
+
+func (dnsc *DNSConfiguratorService) dropSnapshot(domain string) {
+	if dnsc.cache != nil {
+		dnsc.cache.DeleteZone(domain)
+	}
+}
+
+// verified stores a value in the cache that is already published at netcup.
+func (dnsc *DNSConfiguratorService) verified(domain, host, dnstype, value string, records *netcup.DNSRecordSet) {
+	if dnsc.cache == nil {
+		return
+	}
+
+	var recordID string
+	if record := records.GetRecord(host, dnstype); record != nil {
+		recordID = record.ID
+	}
+
+	dnsc.cache.Set(domain, host, dnstype, value, recordID)
+}
+
+// stage stages the value of a queued record in the cache. It is committed
+// once netcup accepted the update.
+func (dnsc *DNSConfiguratorService) stage(domain string, record *netcup.DNSRecord, value string) {
+	if dnsc.cache != nil {
+		dnsc.cache.Stage(domain, record.Hostname, record.Type, value, record.ID)
+	}
+}
+
+func (dnsc *DNSConfiguratorService) commit(domain string) {
+	if dnsc.cache != nil {
+		dnsc.cache.Commit(domain)
+	}
+}
+
+func (dnsc *DNSConfiguratorService) discard(domain string) {
+	if dnsc.cache != nil {
+		dnsc.cache.Discard(domain)
+	}
+}
+
 func (dnsc *DNSConfiguratorService) configureARecord(host string, ipv4 string, records *netcup.DNSRecordSet) (*netcup.DNSRecord, bool) {
+	if ipv4 == RemoveAddress {
+		return dnsc.removeRecord(host, "A", records)
+	}
+
 	var result *netcup.DNSRecord
 	if record := records.GetRecord(host, "A"); record != nil {
 		dnsc.logger.Info("Found one A record for host '%s'.", host)
@@ -181,6 +573,10 @@ func (dnsc *DNSConfiguratorService) configureARecord(host string, ipv4 string, r
 }
 
 func (dnsc *DNSConfiguratorService) configureAAAARecord(host string, ipv6 string, records *netcup.DNSRecordSet) (*netcup.DNSRecord, bool) {
+	if ipv6 == RemoveAddress {
+		return dnsc.removeRecord(host, "AAAA", records)
+	}
+
 	var result *netcup.DNSRecord
 	if record := records.GetRecord(host, "AAAA"); record != nil {
 		dnsc.logger.Info("Found one AAAA record for host '%s'.", host)
@@ -199,3 +595,16 @@ func (dnsc *DNSConfiguratorService) configureAAAARecord(host string, ipv6 string
 
 	return result, true
 }
+
+func (dnsc *DNSConfiguratorService) removeRecord(host, dnstype string, records *netcup.DNSRecordSet) (*netcup.DNSRecord, bool) {
+	record := records.GetRecord(host, dnstype)
+	if record == nil {
+		dnsc.logger.Info("There is no %s record for '%s'. Nothing to remove", dnstype, host)
+		return nil, false
+	}
+
+	dnsc.logger.Info("Found one %s record for host '%s'. Queue for removal...", dnstype, host)
+	record.DeleteRecord = true
+
+	return record, true
+}
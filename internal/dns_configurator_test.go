@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+// fakeClient is a dnsClient that serves the zones and records of an account
+// from memory.
+type fakeClient struct {
+	zones   map[string]*netcup.DNSZone
+	records map[string][]netcup.DNSRecord
+
+	loginErr  error
+	zoneErr   map[string]error
+	updateErr error
+
+	// infoRecords counts the calls of InfoDNSRecords per domain and updates
+	// contains the record sets passed to UpdateDNSRecords.
+	infoRecords map[string]int
+	updates     map[string][]netcup.DNSRecord
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		zones:       make(map[string]*netcup.DNSZone),
+		records:     make(map[string][]netcup.DNSRecord),
+		zoneErr:     make(map[string]error),
+		infoRecords: make(map[string]int),
+		updates:     make(map[string][]netcup.DNSRecord),
+	}
+}
+
+// addZone adds a zone with a specified serial and records.
+func (c *fakeClient) addZone(domain, serial string, records ...netcup.DNSRecord) {
+	c.zones[domain] = &netcup.DNSZone{DomainName: domain, TTL: "300", Serial: serial, Refresh: "0", Retry: "0", Expire: "0"}
+	c.records[domain] = records
+}
+
+func (c *fakeClient) Login() error {
+	return c.loginErr
+}
+
+func (c *fakeClient) InfoDNSZone(domain string) (*netcup.DNSZone, error) {
+	if err := c.zoneErr[domain]; err != nil {
+		return nil, err
+	}
+
+	zone, ok := c.zones[domain]
+	if !ok {
+		return nil, errors.New("netcup: zone not found")
+	}
+
+	copied := *zone
+	return &copied, nil
+}
+
+func (c *fakeClient) InfoDNSRecords(domain string) (*netcup.DNSRecordSet, error) {
+	c.infoRecords[domain]++
+	return netcup.NewDNSRecordSet(append([]netcup.DNSRecord(nil), c.records[domain]...)), nil
+}
+
+func (c *fakeClient) UpdateDNSZone(domain string, zone *netcup.DNSZone) error {
+	copied := *zone
+	c.zones[domain] = &copied
+	return nil
+}
+
+func (c *fakeClient) UpdateDNSRecords(domain string, records *netcup.DNSRecordSet) error {
+	if c.updateErr != nil {
+		return c.updateErr
+	}
+
+	c.updates[domain] = append(c.updates[domain], records.DNSRecords...)
+	for _, update := range records.DNSRecords {
+		replaced := false
+		for i, record := range c.records[domain] {
+			if record.Hostname == update.Hostname && record.Type == update.Type {
+				c.records[domain][i] = update
+				replaced = true
+			}
+		}
+		if !replaced {
+			c.records[domain] = append(c.records[domain], update)
+		}
+	}
+
+	if zone, ok := c.zones[domain]; ok {
+		zone.Serial += "1"
+	}
+
+	return nil
+}
+
+// newTestConfigurator returns a configurator that publishes the specified
+// addresses with fake clients for the accounts.
+func newTestConfigurator(config *Config, cache *Cache, addrs *AddrInfo, clients map[string]*fakeClient) *DNSConfiguratorService {
+	dnsc := NewDNSConfigurator(config, cache, NewLogger(false))
+	dnsc.newClient = func(account Account) dnsClient {
+		for name, client := range clients {
+			if found, _ := config.Account(name); found == account {
+				return client
+			}
+		}
+		return newFakeClient()
+	}
+	dnsc.SetAddrInfo(addrs)
+
+	return dnsc
+}
+
+// testDomain returns a domain that updates the A records of its hosts.
+func testDomain(name string, hosts ...string) Domain {
+	domain := Domain{Name: name, IPv4: true}
+	for _, host := range hosts {
+		domain.Hosts = append(domain.Hosts, Host{Name: host})
+	}
+
+	return domain
+}
+
+func aRecord(id, host, value string) netcup.DNSRecord {
+	return netcup.DNSRecord{ID: id, Hostname: host, Type: "A", Destination: value}
+}
+
+func TestConfigureResult(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup configures the client of the default account.
+		setup       func(client *fakeClient)
+		wantRunErr  bool
+		wantFailure bool
+	}{
+		{
+			name: "all succeeded",
+			setup: func(client *fakeClient) {
+				client.addZone("example.de", "1", aRecord("1", "www", "192.0.2.1"))
+				client.addZone("example.com", "1")
+			},
+		},
+		{
+			name: "some failed",
+			setup: func(client *fakeClient) {
+				client.addZone("example.de", "1")
+				client.zoneErr["example.com"] = errors.New("netcup: zone not found")
+			},
+			wantRunErr: true,
+		},
+		{
+			name: "none configured",
+			setup: func(client *fakeClient) {
+				client.zoneErr["example.de"] = errors.New("netcup: zone not found")
+				client.zoneErr["example.com"] = errors.New("netcup: zone not found")
+			},
+			wantFailure: true,
+		},
+		{
+			name: "login failed",
+			setup: func(client *fakeClient) {
+				client.loginErr = errors.New("netcup: login failed")
+			},
+			wantFailure: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			test.setup(client)
+
+			config := &Config{Domains: []Domain{testDomain("example.de", "www"), testDomain("example.com", "@")}}
+			dnsc := newTestConfigurator(config, nil, &AddrInfo{IPv4: "203.0.113.1"}, map[string]*fakeClient{DefaultAccount: client})
+
+			err := dnsc.Configure()
+
+			var runErr *RunError
+			switch {
+			case test.wantRunErr:
+				if !errors.As(err, &runErr) {
+					t.Errorf("Configure() error = %v, want a RunError", err)
+				}
+			case test.wantFailure:
+				if err == nil || errors.As(err, &runErr) {
+					t.Errorf("Configure() error = %v, want an error other than RunError", err)
+				}
+			case err != nil:
+				t.Errorf("Configure() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigureNamedAccounts(t *testing.T) {
+	work := newFakeClient()
+	work.addZone("example.com", "1", aRecord("1", "www", "192.0.2.1"))
+	private := newFakeClient()
+	private.addZone("example.de", "1", aRecord("2", "www", "192.0.2.1"))
+
+	// The top level credentials are not configured, so their client must not
+	// be used.
+	unused := newFakeClient()
+	unused.loginErr = errors.New("netcup: invalid credentials")
+
+	config := &Config{
+		Accounts: map[string]Account{
+			"work":    {CustomerNumber: 1, APIKey: "work-key", APIPassword: "work-password"},
+			"private": {CustomerNumber: 2, APIKey: "private-key", APIPassword: "private-password"},
+		},
+		Domains: []Domain{testDomain("example.com", "www"), testDomain("example.de", "www")},
+	}
+	config.Domains[0].Account = "work"
+	config.Domains[1].Account = "private"
+
+	clients := map[string]*fakeClient{"work": work, "private": private, DefaultAccount: unused}
+	dnsc := newTestConfigurator(config, nil, &AddrInfo{IPv4: "203.0.113.1"}, clients)
+
+	if err := dnsc.Configure(); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	for domain, client := range map[string]*fakeClient{"example.com": work, "example.de": private} {
+		if got := client.records[domain][0].Destination; got != "203.0.113.1" {
+			t.Errorf("record of %s = %s, want it updated with its account", domain, got)
+		}
+	}
+}
+
+func TestConfigureHostSettings(t *testing.T) {
+	yes, no := true, false
+
+	client := newFakeClient()
+	client.addZone("example.de", "1")
+
+	domain := testDomain("example.de", "www")
+	domain.Hosts = append(domain.Hosts,
+		Host{Name: "vpn", IPv4: &no, IPv6: &yes},
+		Host{Name: "old", Enabled: &no},
+	)
+	config := &Config{Domains: []Domain{domain}}
+
+	addrs := &AddrInfo{IPv4: "203.0.113.1", IPv6: "2001:db8::1"}
+	dnsc := newTestConfigurator(config, nil, addrs, map[string]*fakeClient{DefaultAccount: client})
+
+	if err := dnsc.Configure(); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	var got []string
+	for _, record := range client.records["example.de"] {
+		got = append(got, record.Hostname+" "+record.Type+" "+record.Destination)
+	}
+
+	want := []string{"www A 203.0.113.1", "vpn AAAA 2001:db8::1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+}
+
+func TestConfigureReportsFailureOnce(t *testing.T) {
+	client := newFakeClient()
+	client.addZone("example.de", "1")
+
+	config := &Config{
+		IPSources: map[string]IPSourceConfig{"fixed": {Type: ipSourceStatic, IPv4: "203.0.113.1"}},
+		Domains:   []Domain{testDomain("example.de", "@", "www")},
+	}
+	config.Domains[0].IPv6 = true
+	config.Domains[0].IPSource = "fixed"
+
+	dnsc := newTestConfigurator(config, nil, nil, map[string]*fakeClient{DefaultAccount: client})
+
+	err := dnsc.Configure()
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || len(runErr.Errors) != 1 {
+		t.Fatalf("Configure() error = %v, want a RunError with one failure", err)
+	}
+
+	if got := len(client.updates["example.de"]); got != 2 {
+		t.Errorf("updated %d records, want the 2 A records", got)
+	}
+}
+
+func TestConfigureCommitsAcceptedUpdates(t *testing.T) {
+	tests := []struct {
+		name      string
+		updateErr error
+		want      map[string]string
+	}{
+		{
+			name: "accepted",
+			want: map[string]string{"A": "203.0.113.1"},
+		},
+		{
+			name:      "rejected",
+			updateErr: errors.New("netcup: update failed"),
+			want:      map[string]string{"A": "192.0.2.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			client.addZone("example.de", "1", aRecord("1", "www", "192.0.2.1"))
+			client.updateErr = test.updateErr
+
+			config := &Config{Domains: []Domain{testDomain("example.de", "www")}}
+			cache := NewCache(NewMemoryStateStore(), time.Hour)
+			if err := cache.Load(); err != nil {
+				t.Fatal(err)
+			}
+			cache.Set("example.de", "www", "A", "192.0.2.1", "1")
+			history := len(cache.History())
+
+			dnsc := newTestConfigurator(config, cache, &AddrInfo{IPv4: "203.0.113.1"}, map[string]*fakeClient{DefaultAccount: client})
+			dnsc.Configure()
+
+			assertEntries(t, cache, "example.de", "www", test.want)
+
+			if test.updateErr != nil && len(cache.History()) != history {
+				t.Errorf("rejected update was added to the history: %+v", cache.History())
+			}
+		})
+	}
+}
+
+func TestConfigureReusesZoneSnapshot(t *testing.T) {
+	client := newFakeClient()
+	client.addZone("example.de", "1", aRecord("1", "www", "203.0.113.1"))
+
+	config := &Config{Domains: []Domain{testDomain("example.de", "www")}}
+
+	// Without a timeout the entries always expire, so every run loads the
+	// records.
+	cache := NewCache(NewMemoryStateStore(), 0)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := &AddrInfo{IPv4: "203.0.113.1"}
+	dnsc := newTestConfigurator(config, cache, addrs, map[string]*fakeClient{DefaultAccount: client})
+
+	steps := []struct {
+		name   string
+		before func()
+		// fetches is the total number of InfoDNSRecords calls after the run.
+		fetches int
+	}{
+		{name: "no snapshot", fetches: 1},
+		{name: "serial unchanged", fetches: 1},
+		{name: "serial changed", before: func() { client.zones["example.de"].Serial = "2" }, fetches: 2},
+		{name: "serial unchanged again", fetches: 2},
+		{name: "update", before: func() { addrs.IPv4 = "203.0.113.2" }, fetches: 2},
+		{name: "snapshot dropped after update", fetches: 3},
+		{name: "serial unchanged after update", fetches: 3},
+		{name: "verification", before: func() { config.VerifyRuns = 1 }, fetches: 4},
+	}
+
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+
+		if err := dnsc.Configure(); err != nil {
+			t.Fatalf("%s: Configure() error = %v", step.name, err)
+		}
+
+		if got := client.infoRecords["example.de"]; got != step.fetches {
+			t.Errorf("%s: loaded the records %d times, want %d", step.name, got, step.fetches)
+		}
+	}
+
+	if got := client.records["example.de"][0].Destination; got != "203.0.113.2" {
+		t.Errorf("record = %s, want the updated address", got)
+	}
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+// Drift represents a record whose value at netcup differs from the cached
+// value, for example because it was edited in the netcup CCP.
+type Drift struct {
+	Entry CacheEntry
+	// Remote is the value of the record at netcup. It is RemoveAddress if
+	// there is no such record.
+	Remote string
+}
+
+// FindDrift compares cache entries with the records of a zone and returns
+// every entry that differs. Entries of other domains are ignored.
+func FindDrift(domain string, entries []CacheEntry, records *netcup.DNSRecordSet) []Drift {
+	var drifts []Drift
+	for _, entry := range entries {
+		if entry.Domain != domain {
+			continue
+		}
+
+		remote := RemoveAddress
+		if record := records.GetRecord(entry.Host, entry.Type); record != nil {
+			remote = record.Destination
+		}
+
+		if remote != entry.Value {
+			drifts = append(drifts, Drift{entry, remote})
+		}
+	}
+
+	return drifts
+}
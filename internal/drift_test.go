@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+func TestFindDrift(t *testing.T) {
+	entries := []CacheEntry{
+		{Domain: "example.de", Host: "www", Type: "A", Value: "203.0.113.1"},
+		{Domain: "example.de", Host: "@", Type: "A", Value: "203.0.113.1"},
+		{Domain: "example.de", Host: "mail", Type: "AAAA", Value: "2001:db8::1"},
+		{Domain: "example.de", Host: "gone", Type: "A", Value: "203.0.113.1"},
+		{Domain: "example.com", Host: "www", Type: "A", Value: "203.0.113.9"},
+	}
+	records := netcup.NewDNSRecordSet([]netcup.DNSRecord{
+		aRecord("1", "www", "203.0.113.1"),
+		aRecord("2", "@", "198.51.100.1"),
+		{ID: "3", Hostname: "mail", Type: "AAAA", Destination: "2001:db8::1"},
+	})
+
+	got := FindDrift("example.de", entries, records)
+	want := []Drift{
+		{entries[1], "198.51.100.1"},
+		{entries[3], RemoveAddress},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDrift() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReportDrift(t *testing.T) {
+	disabled, noIPv4 := false, false
+	domain := Domain{Name: "example.de", IPv4: true, Hosts: []Host{
+		{Name: "www"},
+		{Name: "old", Enabled: &disabled},
+		{Name: "v6", IPv4: &noIPv4},
+	}}
+
+	cache := NewCache(NewMemoryStateStore(), time.Hour)
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"www", "old", "v6", "unknown"} {
+		cache.Set("example.de", host, "A", "203.0.113.1", "")
+	}
+
+	records := netcup.NewDNSRecordSet([]netcup.DNSRecord{
+		aRecord("1", "www", "198.51.100.1"),
+		aRecord("2", "old", "198.51.100.1"),
+		aRecord("3", "v6", "198.51.100.1"),
+		aRecord("4", "unknown", "198.51.100.1"),
+	})
+
+	var output bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&output)
+
+	dnsc := NewDNSConfigurator(&Config{Domains: []Domain{domain}}, cache, NewLogger(false))
+	dnsc.reportDrift(domain, records)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "'www.example.de'") {
+		t.Errorf("reported drift:\n%s\nwant only www.example.de", output.String())
+	}
+}
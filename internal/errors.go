@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RunError is returned when a run could only be completed partially. It
+// contains every failure that occurred during the run. Records that were
+// not affected by any of the failures have been configured anyway.
+type RunError struct {
+	Errors []error
+}
+
+// Error returns all collected failures as a single message.
+func (e *RunError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d failure(s) occurred: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the collected failures.
+func (e *RunError) Unwrap() []error {
+	return e.Errors
+}
+
+// add adds an error to the RunError. Errors that were already added are
+// ignored, so a failing ip source is only reported once per run. It returns
+// whether the error was added.
+func (e *RunError) add(err error) bool {
+	for _, existing := range e.Errors {
+		if existing == err {
+			return false
+		}
+	}
+
+	e.Errors = append(e.Errors, err)
+	return true
+}
+
+// errorOrNil returns the RunError or nil if no failures were collected.
+func (e *RunError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
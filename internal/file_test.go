@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ip.cache")
+
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	assertDirEntries(t, dir, "ip.cache")
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory that is not empty cannot be replaced by the rename.
+	path := filepath.Join(dir, "ip.cache")
+	if err := os.MkdirAll(filepath.Join(path, "entry"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("content"), 0600); err == nil {
+		t.Fatal("expected an error when the file cannot be replaced")
+	}
+
+	assertDirEntries(t, dir, "ip.cache")
+	assertDirEntries(t, path, "entry")
+}
+
+// assertDirEntries checks that a directory contains exactly the specified
+// entries, e.g. no temporary files that were left behind.
+func assertDirEntries(t *testing.T, dir string, want ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("entries of %s = %q, want %q", dir, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entries of %s = %q, want %q", dir, got, want)
+		}
+	}
+}
@@ -1,8 +1,20 @@
 package internal
 
 import (
-	"io/ioutil"
-	"net/http"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// RemoveAddress can be used instead of an ip address to remove the
+// corresponding record of a host.
+const RemoveAddress = "remove"
+
+const (
+	ipifyIPv4URL = "https://api.ipify.org?format=text"
+	ipifyIPv6URL = "https://api6.ipify.org?format=text"
 )
 
 // AddrInfo represents the ip addresses of the host
@@ -11,48 +23,97 @@ type AddrInfo struct {
 	IPv6 string
 }
 
-// GetAddrInfo retrieves an AddrInfo instance
-func GetAddrInfo(ipv4 bool, ipv6 bool) (*AddrInfo, error) {
-	adresses := &AddrInfo{}
+// newIpifySource returns an ip source that detects the addresses with ipify.
+// The bind options of the config are honored.
+func newIpifySource(config IPSourceConfig) (*httpSource, error) {
+	config.URL = ""
+	config.IPv4URL = ipifyIPv4URL
+	config.IPv6URL = ipifyIPv6URL
+	config.Method = ""
+	config.Extract = extractText
 
-	if ipv4 {
-		address, err := getIPv4()
-		if err != nil {
-			return nil, err
-		}
-		adresses.IPv4 = address
+	return newHTTPSource(config)
+}
+
+// SetIPv4 sets the IPv4 field to a specified value. The value has to be
+// either an IPv4 address or RemoveAddress.
+func (a *AddrInfo) SetIPv4(value string) error {
+	if value != RemoveAddress && !isIPv4(value) {
+		return fmt.Errorf("invalid IPv4 address '%s'", value)
 	}
 
-	if ipv6 {
-		address, err := getIPv6()
-		if err != nil {
-			return nil, err
-		}
+	a.IPv4 = value
+	return nil
+}
 
-		adresses.IPv6 = address
+// SetIPv6 sets the IPv6 field to a specified value. The value has to be
+// either an IPv6 address or RemoveAddress.
+func (a *AddrInfo) SetIPv6(value string) error {
+	if value != RemoveAddress && !isIPv6(value) {
+		return fmt.Errorf("invalid IPv6 address '%s'", value)
 	}
 
-	return adresses, nil
+	a.IPv6 = value
+	return nil
 }
 
-func getIPv4() (string, error) {
-	return do("https://api.ipify.org?format=text")
-}
+// Parse reads addresses from a reader and sets them on the AddrInfo.
+// The input consists of addresses separated by whitespace or commas. An
+// address is either a plain IPv4 or IPv6 address or has the form
+// 'ipv4=<value>' or 'ipv6=<value>', where value may also be RemoveAddress.
+func (a *AddrInfo) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
 
-func getIPv6() (string, error) {
-	return do("https://api6.ipify.org?format=text")
+	for scanner.Scan() {
+		for _, token := range strings.Split(scanner.Text(), ",") {
+			if token == "" {
+				continue
+			}
+
+			if err := a.parseToken(token); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
 }
 
-func do(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+func (a *AddrInfo) parseToken(token string) error {
+	if key, value, found := strings.Cut(token, "="); found {
+		switch strings.ToLower(key) {
+		case "ipv4":
+			return a.SetIPv4(value)
+		case "ipv6":
+			return a.SetIPv6(value)
+		default:
+			return fmt.Errorf("unknown address family '%s'", key)
+		}
+	}
+
+	if isIPv4(token) {
+		return a.SetIPv4(token)
 	}
-	defer resp.Body.Close()
-	ip, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+
+	if isIPv6(token) {
+		return a.SetIPv6(token)
 	}
 
-	return string(ip), nil
+	return fmt.Errorf("invalid ip address '%s'", token)
+}
+
+// Empty returns true if neither an IPv4 nor an IPv6 address is set.
+func (a *AddrInfo) Empty() bool {
+	return a.IPv4 == "" && a.IPv6 == ""
+}
+
+func isIPv4(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() != nil
+}
+
+func isIPv6(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() == nil
 }
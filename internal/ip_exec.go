@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExecTimeout = 10 * time.Second
+
+	// familyEnv is the environment variable that tells an exec ip source
+	// which address family is requested.
+	familyEnv = "DYNDNS_FAMILY"
+)
+
+var errExecNoCommand = errors.New("exec ip source has no command")
+
+// execSource retrieves the addresses from the output of an external command.
+type execSource struct {
+	command string
+	args    []string
+	env     []string
+	timeout time.Duration
+	regex   *regexp.Regexp
+}
+
+func newExecSource(config IPSourceConfig) (*execSource, error) {
+	if config.Command == "" {
+		return nil, errExecNoCommand
+	}
+
+	regex, err := compileRegex(config.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultExecTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	var env []string
+	for key, value := range config.Env {
+		env = append(env, key+"="+value)
+	}
+
+	return &execSource{
+		command: config.Command,
+		args:    config.Args,
+		env:     env,
+		timeout: timeout,
+		regex:   regex,
+	}, nil
+}
+
+func (s *execSource) IPv4() (string, error) {
+	return s.run(familyIPv4)
+}
+
+func (s *execSource) IPv6() (string, error) {
+	return s.run(familyIPv6)
+}
+
+func (s *execSource) run(family string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Env = append(os.Environ(), s.env...)
+	cmd.Env = append(cmd.Env, familyEnv+"="+family)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command '%s' timed out after %s", s.command, s.timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("command '%s' failed: %w: %s", s.command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return findAddress(stdout.String(), family, s.regex)
+}
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+
+	return regex, nil
+}
+
+// findAddress returns the first address of a specified family in a text. If
+// a regex is specified only its matches are considered. When the regex
+// contains a capturing group, the first group is used instead of the whole
+// match. Otherwise the text is split into words and every word is checked.
+// Prefix lengths like in '2001:db8::1/64' are ignored, as well as loopback
+// and link local addresses.
+func findAddress(text, family string, regex *regexp.Regexp) (string, error) {
+	var candidates []string
+	if regex != nil {
+		for _, match := range regex.FindAllStringSubmatch(text, -1) {
+			if len(match) > 1 {
+				candidates = append(candidates, match[1])
+			} else {
+				candidates = append(candidates, match[0])
+			}
+		}
+	} else {
+		candidates = strings.FieldsFunc(text, func(r rune) bool {
+			return strings.ContainsRune(" \t\r\n,;\"'", r)
+		})
+	}
+
+	for _, candidate := range candidates {
+		address, _, _ := strings.Cut(strings.TrimSpace(candidate), "/")
+
+		ip := net.ParseIP(address)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+			continue
+		}
+
+		if family == familyIPv4 && isIPv4(address) || family == familyIPv6 && isIPv6(address) {
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s address found in output", family)
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFindAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		family  string
+		regex   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "plain address",
+			text:   "203.0.113.1\n",
+			family: familyIPv4,
+			want:   "203.0.113.1",
+		},
+		{
+			name:   "first address of the family",
+			text:   "2001:db8::1 203.0.113.1, 203.0.113.2",
+			family: familyIPv4,
+			want:   "203.0.113.1",
+		},
+		{
+			name:   "prefix length is ignored",
+			text:   "inet6 2001:db8::1/64 scope global",
+			family: familyIPv6,
+			want:   "2001:db8::1",
+		},
+		{
+			name:   "loopback and link local are skipped",
+			text:   "inet6 ::1/128\ninet6 fe80::1/64\ninet6 2001:db8::2/64",
+			family: familyIPv6,
+			want:   "2001:db8::2",
+		},
+		{
+			name:   "address is normalized",
+			text:   "\"2001:0db8:0000::0003\"",
+			family: familyIPv6,
+			want:   "2001:db8::3",
+		},
+		{
+			name:   "regex match",
+			text:   "lan 192.0.2.1 wan 203.0.113.4",
+			family: familyIPv4,
+			regex:  `203\.\S+`,
+			want:   "203.0.113.4",
+		},
+		{
+			name:   "regex group",
+			text:   "lan 192.0.2.1 wan 203.0.113.4",
+			family: familyIPv4,
+			regex:  `wan (\S+)`,
+			want:   "203.0.113.4",
+		},
+		{
+			name:    "no address of the family",
+			text:    "203.0.113.1",
+			family:  familyIPv6,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var regex *regexp.Regexp
+			if test.regex != "" {
+				regex = regexp.MustCompile(test.regex)
+			}
+
+			got, err := findAddress(test.text, test.family, regex)
+			if (err != nil) != test.wantErr || got != test.want {
+				t.Errorf("findAddress() = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
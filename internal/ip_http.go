@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+
+	extractText   = "text"
+	extractRegex  = "regex"
+	extractJSON   = "json"
+	extractHeader = "header"
+)
+
+var errHTTPNoURL = errors.New("http ip source has no url")
+
+// httpSource retrieves the addresses from a response of an http endpoint.
+type httpSource struct {
+	ipv4URL  string
+	ipv6URL  string
+	method   string
+	headers  map[string]string
+	extract  string
+	regex    *regexp.Regexp
+	jsonPath string
+	header   string
+	ipv4     *http.Client
+	ipv6     *http.Client
+}
+
+func newHTTPSource(config IPSourceConfig) (*httpSource, error) {
+	source := &httpSource{
+		ipv4URL:  config.URL,
+		ipv6URL:  config.URL,
+		method:   http.MethodGet,
+		headers:  config.Headers,
+		extract:  config.Extract,
+		jsonPath: config.JSONPath,
+		header:   config.Header,
+	}
+
+	if config.IPv4URL != "" {
+		source.ipv4URL = config.IPv4URL
+	}
+	if config.IPv6URL != "" {
+		source.ipv6URL = config.IPv6URL
+	}
+	if source.ipv4URL == "" && source.ipv6URL == "" {
+		return nil, errHTTPNoURL
+	}
+
+	if config.Method != "" {
+		source.method = strings.ToUpper(config.Method)
+	}
+
+	var err error
+	source.regex, err = compileRegex(config.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	switch source.extract {
+	case "", extractText:
+		source.extract = extractText
+	case extractRegex:
+		if source.regex == nil {
+			return nil, errors.New("extract 'regex' needs a REGEX")
+		}
+	case extractJSON:
+		if source.jsonPath == "" {
+			return nil, errors.New("extract 'json' needs a JSON-PATH")
+		}
+	case extractHeader:
+		if source.header == "" {
+			return nil, errors.New("extract 'header' needs a HEADER")
+		}
+	default:
+		return nil, fmt.Errorf("unknown extract '%s'", source.extract)
+	}
+
+	timeout := defaultHTTPTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	bind := bindOptions{
+		iface:      config.Interface,
+		sourceIPv4: config.SourceIPv4,
+		sourceIPv6: config.SourceIPv6,
+	}
+
+	source.ipv4, err = newHTTPClient(familyIPv4, bind, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	source.ipv6, err = newHTTPClient(familyIPv6, bind, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+func (s *httpSource) IPv4() (string, error) {
+	return s.fetch(s.ipv4, s.ipv4URL, familyIPv4)
+}
+
+func (s *httpSource) IPv6() (string, error) {
+	return s.fetch(s.ipv6, s.ipv6URL, familyIPv6)
+}
+
+func (s *httpSource) fetch(client *http.Client, url, family string) (string, error) {
+	if url == "" {
+		return "", fmt.Errorf("no url for %s configured", family)
+	}
+
+	req, err := http.NewRequest(s.method, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s %s returned status %s", s.method, url, resp.Status)
+	}
+
+	switch s.extract {
+	case extractRegex:
+		return findAddress(string(body), family, s.regex)
+	case extractJSON:
+		value, err := lookupJSONPath(body, s.jsonPath)
+		if err != nil {
+			return "", err
+		}
+		return findAddress(value, family, nil)
+	case extractHeader:
+		return findAddress(resp.Header.Get(s.header), family, nil)
+	default:
+		return findAddress(string(body), family, nil)
+	}
+}
+
+// lookupJSONPath returns the value at a specified path in a json document.
+// The path consists of object keys and array indices separated by dots, for
+// example 'data.addresses.0.ip'.
+func lookupJSONPath(document []byte, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return "", err
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			next, ok := current[key]
+			if !ok {
+				return "", fmt.Errorf("json path '%s': key '%s' not found", path, key)
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(current) {
+				return "", fmt.Errorf("json path '%s': invalid index '%s'", path, key)
+			}
+			value = current[index]
+		default:
+			return "", fmt.Errorf("json path '%s': cannot descend into '%s'", path, key)
+		}
+	}
+
+	result, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("json path '%s' is not a string", path)
+	}
+
+	return result, nil
+}
+
+// bindOptions specify how outgoing connections of an ip source are bound.
+// This allows to discover the public address of every uplink in multi-WAN
+// setups with policy routing.
+type bindOptions struct {
+	iface      string
+	sourceIPv4 string
+	sourceIPv6 string
+}
+
+// dialer returns a net.Dialer for a specified address family that honors the
+// bindOptions.
+func (b bindOptions) dialer(family string, timeout time.Duration) (*net.Dialer, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if b.iface != "" {
+		control, err := bindToDevice(b.iface)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Control = control
+	}
+
+	source := b.sourceIPv4
+	if family == familyIPv6 {
+		source = b.sourceIPv6
+	}
+
+	if source != "" {
+		if family == familyIPv4 && !isIPv4(source) || family == familyIPv6 && !isIPv6(source) {
+			return nil, fmt.Errorf("invalid %s source address '%s'", family, source)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(source)}
+	}
+
+	return dialer, nil
+}
+
+// newHTTPClient returns an http client that only connects with the specified
+// address family and binds its connections as specified.
+func newHTTPClient(family string, bind bindOptions, timeout time.Duration) (*http.Client, error) {
+	network := "tcp4"
+	if family == familyIPv6 {
+		network = "tcp6"
+	}
+
+	dialer, err := bind.dialer(family, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
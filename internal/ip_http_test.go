@@ -0,0 +1,34 @@
+package internal
+
+import "testing"
+
+func TestLookupJSONPath(t *testing.T) {
+	document := []byte(`{"ip": "203.0.113.1", "data": {"addresses": [{"ip": "2001:db8::1"}, {"ip": "203.0.113.2"}], "port": 80}}`)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "ip", want: "203.0.113.1"},
+		{path: "data.addresses.0.ip", want: "2001:db8::1"},
+		{path: "data.addresses.1.ip", want: "203.0.113.2"},
+		{path: "missing", wantErr: true},
+		{path: "data.addresses.2.ip", wantErr: true},
+		{path: "data.addresses.x.ip", wantErr: true},
+		{path: "ip.address", wantErr: true},
+		{path: "data.port", wantErr: true},
+		{path: "data", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := lookupJSONPath(document, test.path)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("lookupJSONPath(%s) = %q, %v, want %q", test.path, got, err, test.want)
+		}
+	}
+
+	if _, err := lookupJSONPath([]byte("203.0.113.1"+"}"), "ip"); err == nil {
+		t.Error("expected an error for an invalid document")
+	}
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ec2TokenPath   = "/latest/api/token"
+	ec2TokenTTL    = "21600"
+	ec2TokenHeader = "X-aws-ec2-metadata-token"
+)
+
+// metadataProvider describes where a cloud metadata service publishes the
+// public addresses of an instance.
+type metadataProvider struct {
+	endpoint string
+	ipv4Path string
+	ipv6Path string
+	headers  map[string]string
+	imdsv2   bool
+}
+
+var metadataProviders = map[string]metadataProvider{
+	"ec2": {
+		endpoint: "http://169.254.169.254",
+		ipv4Path: "/latest/meta-data/public-ipv4",
+		ipv6Path: "/latest/meta-data/ipv6",
+		imdsv2:   true,
+	},
+	"openstack": {
+		endpoint: "http://169.254.169.254",
+		ipv4Path: "/latest/meta-data/public-ipv4",
+	},
+	"hetzner": {
+		endpoint: "http://169.254.169.254",
+		ipv4Path: "/hetzner/v1/metadata/public-ipv4",
+	},
+	"gce": {
+		endpoint: "http://metadata.google.internal",
+		ipv4Path: "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+		ipv6Path: "/computeMetadata/v1/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6",
+		headers:  map[string]string{"Metadata-Flavor": "Google"},
+	},
+}
+
+// metadataSource retrieves the addresses from the metadata service of a
+// cloud provider.
+type metadataSource struct {
+	name     string
+	provider metadataProvider
+	client   *http.Client
+	token    string
+}
+
+func newMetadataSource(config IPSourceConfig) (*metadataSource, error) {
+	provider, ok := metadataProviders[config.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown metadata provider '%s'", config.Provider)
+	}
+
+	if config.Endpoint != "" {
+		provider.endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	}
+
+	timeout := defaultHTTPTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	// The metadata service is link-local, so the requests must never be sent
+	// to a proxy from the environment like with the default transport.
+	transport := &http.Transport{Proxy: nil}
+
+	return &metadataSource{
+		name:     config.Provider,
+		provider: provider,
+		client:   &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+func (s *metadataSource) IPv4() (string, error) {
+	return s.lookup(s.provider.ipv4Path, familyIPv4)
+}
+
+func (s *metadataSource) IPv6() (string, error) {
+	return s.lookup(s.provider.ipv6Path, familyIPv6)
+}
+
+func (s *metadataSource) lookup(path, family string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("metadata provider '%s' does not publish an %s address", s.name, family)
+	}
+
+	headers := make(map[string]string)
+	for key, value := range s.provider.headers {
+		headers[key] = value
+	}
+
+	if s.provider.imdsv2 {
+		token, err := s.imdsToken()
+		if err != nil {
+			return "", err
+		}
+		headers[ec2TokenHeader] = token
+	}
+
+	body, err := s.request(http.MethodGet, path, headers)
+	if err != nil {
+		return "", err
+	}
+
+	return findAddress(body, family, nil)
+}
+
+// imdsToken returns a session token for the EC2 instance metadata service
+// version 2. The token is requested once and reused for both families.
+func (s *metadataSource) imdsToken() (string, error) {
+	if s.token != "" {
+		return s.token, nil
+	}
+
+	token, err := s.request(http.MethodPut, ec2TokenPath, map[string]string{
+		ec2TokenHeader + "-ttl-seconds": ec2TokenTTL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("requesting IMDSv2 token: %w", err)
+	}
+
+	s.token = strings.TrimSpace(token)
+	return s.token, nil
+}
+
+func (s *metadataSource) request(method, path string, headers map[string]string) (string, error) {
+	url := s.provider.endpoint + path
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s %s returned status %s", method, url, resp.Status)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataSource(t *testing.T) {
+	tests := []struct {
+		provider string
+		// responses maps the paths to their responses. Requests without the
+		// required headers are answered with 401.
+		responses map[string]string
+		headers   map[string]string
+		ipv4      string
+		ipv6      string
+	}{
+		{
+			provider: "ec2",
+			responses: map[string]string{
+				"/latest/meta-data/public-ipv4": "203.0.113.7",
+				"/latest/meta-data/ipv6":        "2001:db8::7",
+			},
+			headers: map[string]string{ec2TokenHeader: "token"},
+			ipv4:    "203.0.113.7",
+			ipv6:    "2001:db8::7",
+		},
+		{
+			provider: "openstack",
+			responses: map[string]string{
+				"/latest/meta-data/public-ipv4": "203.0.113.8\n",
+			},
+			ipv4: "203.0.113.8",
+		},
+		{
+			provider: "hetzner",
+			responses: map[string]string{
+				"/hetzner/v1/metadata/public-ipv4": "203.0.113.9",
+			},
+			ipv4: "203.0.113.9",
+		},
+		{
+			provider: "gce",
+			responses: map[string]string{
+				"/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip":        "203.0.113.10",
+				"/computeMetadata/v1/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6": "2001:db8::10",
+			},
+			headers: map[string]string{"Metadata-Flavor": "Google"},
+			ipv4:    "203.0.113.10",
+			ipv6:    "2001:db8::10",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.provider, func(t *testing.T) {
+			tokens := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut && r.URL.Path == ec2TokenPath {
+					tokens++
+					w.Write([]byte("token\n"))
+					return
+				}
+
+				for key, value := range test.headers {
+					if r.Header.Get(key) != value {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+				}
+
+				response, ok := test.responses[r.URL.Path]
+				if !ok || r.Method != http.MethodGet {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(response))
+			}))
+			defer server.Close()
+
+			source, err := newMetadataSource(IPSourceConfig{Provider: test.provider, Endpoint: server.URL + "/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if transport, ok := source.client.Transport.(*http.Transport); !ok || transport.Proxy != nil {
+				t.Error("metadata requests must not use a proxy")
+			}
+
+			ipv4, err := source.IPv4()
+			if ipv4 != test.ipv4 || (err != nil) != (test.ipv4 == "") {
+				t.Errorf("IPv4() = %q, %v, want %q", ipv4, err, test.ipv4)
+			}
+
+			ipv6, err := source.IPv6()
+			if ipv6 != test.ipv6 || (err != nil) != (test.ipv6 == "") {
+				t.Errorf("IPv6() = %q, %v, want %q", ipv6, err, test.ipv6)
+			}
+
+			if test.provider == "ec2" && tokens != 1 {
+				t.Errorf("requested %d IMDSv2 tokens, want 1", tokens)
+			}
+		})
+	}
+}
+
+func TestMetadataSourceUnknownProvider(t *testing.T) {
+	if _, err := newMetadataSource(IPSourceConfig{Provider: "azure"}); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
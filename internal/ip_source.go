@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultIPSource is the name of the ip source that is used when a domain
+	// or host does not reference a source. Unless it is overridden in the
+	// config it detects the addresses with ipify.
+	DefaultIPSource = "default"
+
+	ipSourceIpify  = "ipify"
+	ipSourceStatic = "static"
+	ipSourceExec   = "exec"
+	ipSourceHTTP   = "http"
+	ipSourceMeta   = "metadata"
+
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+)
+
+// IPSource represents a source for the public ip addresses of the host.
+type IPSource interface {
+	IPv4() (string, error)
+	IPv6() (string, error)
+}
+
+// NewIPSource returns the IPSource described by a specified IPSourceConfig.
+func NewIPSource(config IPSourceConfig) (IPSource, error) {
+	switch config.Type {
+	case "", ipSourceIpify:
+		return newIpifySource(config)
+	case ipSourceStatic:
+		return &staticSource{config.IPv4, config.IPv6}, nil
+	case ipSourceExec:
+		return newExecSource(config)
+	case ipSourceHTTP:
+		return newHTTPSource(config)
+	case ipSourceMeta:
+		return newMetadataSource(config)
+	default:
+		return nil, fmt.Errorf("unknown ip source type '%s'", config.Type)
+	}
+}
+
+type staticSource struct {
+	ipv4 string
+	ipv6 string
+}
+
+func (s *staticSource) IPv4() (string, error) {
+	if s.ipv4 == "" {
+		return "", fmt.Errorf("static ip source has no IPv4 address")
+	}
+
+	return s.ipv4, nil
+}
+
+func (s *staticSource) IPv6() (string, error) {
+	if s.ipv6 == "" {
+		return "", fmt.Errorf("static ip source has no IPv6 address")
+	}
+
+	return s.ipv6, nil
+}
+
+// AddrResolver resolves the addresses of named ip sources. Every source is
+// queried at most once per address family. The result is reused for every
+// domain and host that references the source.
+type AddrResolver struct {
+	sources map[string]IPSource
+	results map[string]*addrResult
+}
+
+type addrResult struct {
+	address string
+	err     error
+}
+
+// NewAddrResolver returns an AddrResolver for the specified ip source
+// configurations. The DefaultIPSource is always available.
+func NewAddrResolver(configs map[string]IPSourceConfig) (*AddrResolver, error) {
+	sources := make(map[string]IPSource)
+	if _, ok := configs[DefaultIPSource]; !ok {
+		source, err := newIpifySource(IPSourceConfig{})
+		if err != nil {
+			return nil, err
+		}
+		sources[DefaultIPSource] = source
+	}
+
+	for name, config := range configs {
+		source, err := NewIPSource(config)
+		if err != nil {
+			return nil, fmt.Errorf("ip source '%s': %w", name, err)
+		}
+		sources[name] = source
+	}
+
+	return &AddrResolver{
+		sources: sources,
+		results: make(map[string]*addrResult),
+	}, nil
+}
+
+// IPv4 returns the IPv4 address of the ip source with the specified name.
+func (r *AddrResolver) IPv4(name string) (string, error) {
+	return r.resolve(name, familyIPv4)
+}
+
+// IPv6 returns the IPv6 address of the ip source with the specified name.
+func (r *AddrResolver) IPv6(name string) (string, error) {
+	return r.resolve(name, familyIPv6)
+}
+
+func (r *AddrResolver) resolve(name, family string) (string, error) {
+	if name == "" {
+		name = DefaultIPSource
+	}
+
+	key := name + "/" + family
+	if result, ok := r.results[key]; ok {
+		return result.address, result.err
+	}
+
+	source, ok := r.sources[name]
+	if !ok {
+		return "", fmt.Errorf("unknown ip source '%s'", name)
+	}
+
+	result := &addrResult{}
+	if family == familyIPv4 {
+		result.address, result.err = source.IPv4()
+	} else {
+		result.address, result.err = source.IPv6()
+	}
+
+	if result.err != nil {
+		result.err = fmt.Errorf("ip source '%s': %w", name, result.err)
+	}
+
+	r.results[key] = result
+	return result.address, result.err
+}
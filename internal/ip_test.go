@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddrInfoParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    AddrInfo
+		wantErr bool
+	}{
+		{
+			name:  "both families",
+			input: "203.0.113.1 2001:db8::1\n",
+			want:  AddrInfo{IPv4: "203.0.113.1", IPv6: "2001:db8::1"},
+		},
+		{
+			name:  "comma separated in any order",
+			input: "2001:db8::1,203.0.113.1",
+			want:  AddrInfo{IPv4: "203.0.113.1", IPv6: "2001:db8::1"},
+		},
+		{
+			name:  "keys",
+			input: "IPV4=203.0.113.1\nipv6=remove\n",
+			want:  AddrInfo{IPv4: "203.0.113.1", IPv6: RemoveAddress},
+		},
+		{
+			name:  "empty input",
+			input: " \n",
+			want:  AddrInfo{},
+		},
+		{
+			name:    "ipv4 as ipv6",
+			input:   "ipv6=203.0.113.1",
+			wantErr: true,
+		},
+		{
+			name:    "ipv6 as ipv4",
+			input:   "ipv4=2001:db8::1",
+			wantErr: true,
+		},
+		{
+			name:    "unknown family",
+			input:   "ipv5=203.0.113.1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid address",
+			input:   "203.0.113.1 example.de",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got AddrInfo
+			err := got.Parse(strings.NewReader(test.input))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && got != test.want {
+				t.Errorf("Parse() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const lockRetryInterval = 100 * time.Millisecond
+
+// ErrLocked indicates that a lock is held by another process.
+var ErrLocked = errors.New("lock is held by another process")
+
+// FileLock represents an advisory lock on a file.
+type FileLock struct {
+	file *os.File
+}
+
+// AcquireLock acquires an exclusive advisory lock on the file at a specified
+// path. The file is created if it does not exist. If the lock is held by
+// another process it retries until the wait duration is exceeded and then
+// returns ErrLocked. A wait duration of zero tries only once.
+func AcquireLock(path string, wait time.Duration) (*FileLock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if locked {
+			return &FileLock{file}, nil
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, ErrLocked
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Release releases the lock.
+func (l *FileLock) Release() error {
+	err := unlock(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
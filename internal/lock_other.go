@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package internal
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockUnsupported = errors.New("file locks are not supported on this platform")
+
+// tryLock fails because concurrent runs could not be detected on this
+// platform.
+func tryLock(file *os.File) (bool, error) {
+	return false, errLockUnsupported
+}
+
+func unlock(file *os.File) error {
+	return errLockUnsupported
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	lock, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const wait = 300 * time.Millisecond
+	started := time.Now()
+	if _, err := AcquireLock(path, wait); !errors.Is(err, ErrLocked) {
+		t.Fatalf("AcquireLock() error = %v, want ErrLocked", err)
+	}
+	if waited := time.Since(started); waited < wait {
+		t.Errorf("AcquireLock() gave up after %v, want at least %v", waited, wait)
+	}
+
+	// A waiting run gets the lock as soon as it is released.
+	go func() {
+		time.Sleep(wait / 2)
+		lock.Release()
+	}()
+
+	second, err := AcquireLock(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v after the lock was released", err)
+	}
+	second.Release()
+}
+
+func TestFileStateStoreLock(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "ip.cache")
+	store := NewFileStateStore(location)
+
+	assertLocked := func(want bool) {
+		t.Helper()
+
+		lock, err := AcquireLock(location+".lock", 0)
+		if locked := errors.Is(err, ErrLocked); locked != want {
+			t.Fatalf("locked = %v, want %v (error %v)", locked, want, err)
+		}
+		if lock != nil {
+			lock.Release()
+		}
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is held until the state is saved, so no other run can
+	// change it in between.
+	assertLocked(true)
+
+	if err := store.Save(state); err != nil {
+		t.Fatal(err)
+	}
+	assertLocked(false)
+
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	assertLocked(false)
+
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertLocked(false)
+}
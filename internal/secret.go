@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	redacted = "[REDACTED]"
+
+	// dockerSecretsDir is the directory docker and podman mount secrets to.
+	dockerSecretsDir = "/run/secrets"
+	// credentialsDirEnv is the environment variable systemd sets to the
+	// directory of the credentials loaded with LoadCredential.
+	credentialsDirEnv = "CREDENTIALS_DIRECTORY"
+
+	apiKeySecret      = "apikey"
+	apiPasswordSecret = "apipassword"
+)
+
+// Secret is a string that is redacted whenever it is printed, logged or
+// encoded. Use string(secret) to get the actual value.
+type Secret string
+
+// String returns a placeholder instead of the secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+// GoString returns a placeholder instead of the secret.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON encodes a placeholder instead of the secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", s.String())), nil
+}
+
+// MarshalYAML encodes a placeholder instead of the secret.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// credentialHeaderRegex matches the names of http headers that usually carry
+// credentials like 'Authorization', 'Cookie' or 'X-Api-Key'.
+var credentialHeaderRegex = regexp.MustCompile(`(?i)auth|cookie|token|key|secret|passw|session|signature`)
+
+// Headers are the http headers of an ip source. The values of headers whose
+// names look like credentials are redacted whenever they are encoded.
+type Headers map[string]string
+
+// MarshalJSON encodes the headers with the credentials redacted.
+func (h Headers) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.redacted())
+}
+
+// MarshalYAML encodes the headers with the credentials redacted.
+func (h Headers) MarshalYAML() (interface{}, error) {
+	return h.redacted(), nil
+}
+
+func (h Headers) redacted() map[string]string {
+	if h == nil {
+		return nil
+	}
+
+	redactedHeaders := make(map[string]string, len(h))
+	for name, value := range h {
+		if credentialHeaderRegex.MatchString(name) {
+			value = Secret(value).String()
+		}
+		redactedHeaders[name] = value
+	}
+
+	return redactedHeaders
+}
+
+// DefaultSecretDirs returns the directories secrets are looked up in. These
+// are the systemd credentials directory if it is set and the directory of
+// docker secrets.
+func DefaultSecretDirs() []string {
+	var dirs []string
+	if dir := os.Getenv(credentialsDirEnv); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	return append(dirs, dockerSecretsDir)
+}
+
+// resolveSecrets loads the api keys and passwords of all accounts. A secret
+// is read from the file specified with the corresponding -FILE key. Without
+// such a key and without a value in the config the secret is looked up in
+// the specified directories. The secrets of the account 'work' are looked up
+// as 'work_apikey' and 'work_apipassword'. A file configured together with
+// a value takes precedence. Across layers the one that was set last wins, see
+// applyLayer.
+func (c *Config) resolveSecrets(dirs []string) error {
+	if err := resolveSecret(&c.APIKey, c.APIKeyFile, apiKeySecret, dirs); err != nil {
+		return err
+	}
+
+	if err := resolveSecret(&c.APIPassword, c.APIPasswordFile, apiPasswordSecret, dirs); err != nil {
+		return err
+	}
+
+	for _, name := range sortedNames(c.Accounts) {
+		account := c.Accounts[name]
+
+		if err := resolveSecret(&account.APIKey, account.APIKeyFile, name+"_"+apiKeySecret, dirs); err != nil {
+			return fmt.Errorf("account %s: %w", name, err)
+		}
+
+		if err := resolveSecret(&account.APIPassword, account.APIPasswordFile, name+"_"+apiPasswordSecret, dirs); err != nil {
+			return fmt.Errorf("account %s: %w", name, err)
+		}
+
+		c.Accounts[name] = account
+	}
+
+	return nil
+}
+
+func resolveSecret(value *Secret, file, name string, dirs []string) error {
+	if file != "" {
+		secret, err := readSecret(file)
+		if err != nil {
+			return err
+		}
+		*value = secret
+		return nil
+	}
+
+	if *value != "" {
+		return nil
+	}
+
+	secret, err := lookupSecret(dirs, name)
+	if err != nil {
+		return err
+	}
+	*value = secret
+
+	return nil
+}
+
+// lookupSecret returns the secret with a specified name from the first
+// directory that contains it. It returns an empty secret if none does.
+func lookupSecret(dirs []string, name string) (Secret, error) {
+	for _, dir := range dirs {
+		value, err := readSecret(filepath.Join(dir, name))
+		if err == nil {
+			return value, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// readSecret reads a secret from a file. Surrounding whitespace like the
+// trailing newline most editors add is removed.
+func readSecret(filename string) (Secret, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", err
+		}
+		return "", fmt.Errorf("secret %s: %w", filename, err)
+	}
+
+	return Secret(strings.TrimSpace(string(content))), nil
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecretRedaction(t *testing.T) {
+	secret := Secret("s3cr3t")
+
+	if got := secret.String(); got != redacted {
+		t.Errorf("String() = %q", got)
+	}
+	if got := fmt.Sprintf("%v %s %#v", secret, secret, secret); got != `[REDACTED] [REDACTED] "[REDACTED]"` {
+		t.Errorf("Sprintf() = %q", got)
+	}
+	if got := Secret("").String(); got != "" {
+		t.Errorf("String() of an empty secret = %q", got)
+	}
+
+	value := struct {
+		APIKey  Secret            `json:"APIKEY" yaml:"APIKEY"`
+		Headers Headers           `json:"HEADERS" yaml:"HEADERS"`
+		Env     map[string]string `json:"ENV" yaml:"ENV"`
+	}{
+		APIKey:  secret,
+		Headers: Headers{"Accept": "text/plain", "Authorization": "Bearer token", "X-Api-Key": "key"},
+		Env:     map[string]string{"LC_ALL": "C"},
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"APIKEY":"[REDACTED]","HEADERS":{"Accept":"text/plain","Authorization":"[REDACTED]","X-Api-Key":"[REDACTED]"},"ENV":{"LC_ALL":"C"}}`
+	if string(encoded) != want {
+		t.Errorf("json.Marshal() = %s, want %s", encoded, want)
+	}
+
+	encoded, err = yaml.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "APIKEY: '[REDACTED]'\nHEADERS:\n    Accept: text/plain\n    Authorization: '[REDACTED]'\n    X-Api-Key: '[REDACTED]'\nENV:\n    LC_ALL: C\n"
+	if string(encoded) != want {
+		t.Errorf("yaml.Marshal() = %q, want %q", encoded, want)
+	}
+
+	// The headers themselves keep their values.
+	if value.Headers["Authorization"] != "Bearer token" {
+		t.Errorf("Authorization = %q", value.Headers["Authorization"])
+	}
+}
+
+func TestDefaultSecretDirs(t *testing.T) {
+	t.Setenv(credentialsDirEnv, "")
+	if got, want := DefaultSecretDirs(), []string{dockerSecretsDir}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultSecretDirs() = %v, want %v", got, want)
+	}
+
+	t.Setenv(credentialsDirEnv, "/run/credentials/dyndns.service")
+	if got, want := DefaultSecretDirs(), []string{"/run/credentials/dyndns.service", dockerSecretsDir}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultSecretDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials")
+	secrets := filepath.Join(dir, "secrets")
+	for _, d := range []string{credentials, secrets} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(dir, "apikey.txt"), "file-key\n")
+	writeTestFile(t, filepath.Join(credentials, "apikey"), "credentials-key\n")
+	writeTestFile(t, filepath.Join(secrets, "apikey"), "secrets-key")
+	writeTestFile(t, filepath.Join(secrets, "apipassword"), " secrets-password \n")
+	writeTestFile(t, filepath.Join(secrets, "work_apikey"), "work-key")
+
+	dirs := []string{credentials, secrets}
+
+	tests := []struct {
+		name         string
+		config       Config
+		wantKey      Secret
+		wantPassword Secret
+		wantErr      bool
+	}{
+		{
+			name:         "lookup in the directories",
+			wantKey:      "credentials-key",
+			wantPassword: "secrets-password",
+		},
+		{
+			name:         "value",
+			config:       Config{APIKey: "value", APIPassword: "value"},
+			wantKey:      "value",
+			wantPassword: "value",
+		},
+		{
+			name:         "file",
+			config:       Config{APIKey: "value", APIKeyFile: filepath.Join(dir, "apikey.txt")},
+			wantKey:      "file-key",
+			wantPassword: "secrets-password",
+		},
+		{
+			name:    "missing file",
+			config:  Config{APIKeyFile: filepath.Join(dir, "missing")},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			err := config.resolveSecrets(dirs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("resolveSecrets() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			if config.APIKey != test.wantKey || config.APIPassword != test.wantPassword {
+				t.Errorf("resolveSecrets() = %q, %q, want %q, %q",
+					string(config.APIKey), string(config.APIPassword), string(test.wantKey), string(test.wantPassword))
+			}
+		})
+	}
+
+	t.Run("accounts", func(t *testing.T) {
+		config := Config{Accounts: map[string]Account{"work": {}}}
+		if err := config.resolveSecrets(dirs); err != nil {
+			t.Fatal(err)
+		}
+
+		account := config.Accounts["work"]
+		if account.APIKey != "work-key" || account.APIPassword != "" {
+			t.Errorf("account = %q, %q, want work-key and no password", string(account.APIKey), string(account.APIPassword))
+		}
+	})
+}
+
+func TestConfigLoaderSecretPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "apikey")
+	writeTestFile(t, keyFile, "file-key\n")
+
+	const domains = "CUSTOMERNR: 1\nAPIPASSWORD: password\nDOMAINS:\n  - NAME: example.de\n    TTL: 300\n    HOSTS: [www]\n"
+
+	tests := []struct {
+		name      string
+		user      string
+		file      string
+		env       []string
+		overrides []string
+		want      Secret
+	}{
+		{
+			name: "value replaces the file of a lower layer",
+			file: "APIKEY-FILE: " + keyFile + "\n" + domains,
+			env:  []string{"DYNDNS_APIKEY=env-key"},
+			want: "env-key",
+		},
+		{
+			name: "file replaces the value of a lower layer",
+			file: "APIKEY: file-value\n" + domains,
+			env:  []string{"DYNDNS_APIKEY_FILE=" + keyFile},
+			want: "file-key",
+		},
+		{
+			name:      "override replaces the file",
+			user:      "APIKEY-FILE: " + keyFile + "\n",
+			file:      domains,
+			overrides: []string{"APIKEY=override-key"},
+			want:      "override-key",
+		},
+		{
+			name: "file of a lower layer is kept",
+			user: "APIKEY-FILE: " + keyFile + "\n",
+			file: domains,
+			want: "file-key",
+		},
+		{
+			name: "file wins within a layer",
+			file: "APIKEY: file-value\nAPIKEY-FILE: " + keyFile + "\n" + domains,
+			want: "file-key",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loader := &ConfigLoader{
+				File:      filepath.Join(t.TempDir(), "config.yml"),
+				Env:       test.env,
+				Overrides: test.overrides,
+			}
+			writeTestFile(t, loader.File, test.file)
+
+			if test.user != "" {
+				loader.UserFile = filepath.Join(t.TempDir(), "user.yml")
+				writeTestFile(t, loader.UserFile, test.user)
+			}
+
+			config, err := loader.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.APIKey != test.want {
+				t.Errorf("APIKEY = %q, want %q", string(config.APIKey), string(test.want))
+			}
+		})
+	}
+}
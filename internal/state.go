@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+const (
+	// StateBackendFile stores the state in a JSON file.
+	StateBackendFile = "file"
+	// StateBackendMemory keeps the state in memory only.
+	StateBackendMemory = "memory"
+	// StateBackendBolt stores the state in an embedded bbolt database.
+	StateBackendBolt = "bolt"
+
+	// stateVersion is the version of the state format. It has to be
+	// increased on every incompatible change of the format.
+	stateVersion = 1
+
+	defaultBoltFile = "state.db"
+)
+
+// State represents everything that is kept between two runs.
+type State struct {
+	Entries []CacheEntry            `json:"entries"`
+	History []HistoryEntry          `json:"history,omitempty"`
+	Zones   map[string]ZoneSnapshot `json:"zones,omitempty"`
+	LastRun *RunResult              `json:"lastRun,omitempty"`
+
+	// Skipped contains the records that were not configured on purpose,
+	// e.g. because they do not exist and missing records are skipped. They
+	// are not loaded from netcup again until the cache timeout expires.
+	Skipped []CacheEntry `json:"skipped,omitempty"`
+
+	// Fingerprints contains the fingerprint of the config of every domain
+	// the entries were created with.
+	Fingerprints map[string]string `json:"fingerprints,omitempty"`
+
+	// Runs is the number of runs since the last verification and
+	// LastVerification the time of the last run that bypassed the cache.
+	Runs             int       `json:"runs"`
+	LastVerification time.Time `json:"lastVerification"`
+
+	legacy map[string]legacyEntry
+}
+
+// HistoryEntry represents a change of the value of a record.
+type HistoryEntry struct {
+	Domain string    `json:"domain"`
+	Host   string    `json:"host"`
+	Type   string    `json:"type"`
+	Value  string    `json:"value"`
+	Time   time.Time `json:"time"`
+}
+
+// ZoneSnapshot represents the records of a zone as they were last fetched
+// from netcup.
+type ZoneSnapshot struct {
+	Serial  string             `json:"serial"`
+	Records []netcup.DNSRecord `json:"records"`
+	Fetched time.Time          `json:"fetched"`
+}
+
+// RunResult represents the outcome of a run.
+type RunResult struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Failures []string  `json:"failures,omitempty"`
+}
+
+// StateStore represents a backend that persists the State.
+type StateStore interface {
+	// Load returns the stored state or an empty state if nothing was
+	// stored yet. A store that is shared between processes stays locked
+	// until the state is saved or Unlock is called, so no other process can
+	// change it in between.
+	Load() (*State, error)
+	// Save stores the state and releases the lock of Load.
+	Save(state *State) error
+	// Unlock releases the lock of Load without saving.
+	Unlock() error
+	// Close releases all resources of the store.
+	Close() error
+}
+
+// NewStateStore returns the StateStore for a specified backend. The location
+// is the file or database of the backend. When the location is an empty
+// string the user cache dir is used.
+func NewStateStore(backend, location string) (StateStore, error) {
+	switch backend {
+	case "", StateBackendFile:
+		if location == "" {
+			dir, err := defaultCacheDir()
+			if err != nil {
+				return nil, err
+			}
+			location = dir + "/" + defaultIPCache
+		}
+		return NewFileStateStore(location), nil
+	case StateBackendMemory:
+		return NewMemoryStateStore(), nil
+	case StateBackendBolt:
+		if location == "" {
+			dir, err := defaultCacheDir()
+			if err != nil {
+				return nil, err
+			}
+			location = dir + "/" + defaultBoltFile
+		}
+		return NewBoltStateStore(location)
+	default:
+		return nil, fmt.Errorf("unknown state backend '%s'", backend)
+	}
+}
+
+func newState() *State {
+	return &State{
+		Zones:        make(map[string]ZoneSnapshot),
+		Fingerprints: make(map[string]string),
+	}
+}
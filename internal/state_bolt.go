@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltBucket = []byte("dyndns-netcup-go")
+
+	boltKeyVersion = []byte("version")
+	boltKeyEntries = []byte("entries")
+	boltKeyHistory = []byte("history")
+	boltKeyZones   = []byte("zones")
+	boltKeyLastRun = []byte("lastRun")
+	boltKeyRuns    = []byte("runs")
+	boltKeyVerify  = []byte("lastVerification")
+	boltKeyPrints  = []byte("fingerprints")
+	boltKeySkipped = []byte("skipped")
+)
+
+// BoltStateStore stores the State in an embedded bbolt database. Every part
+// of the state is stored under its own key and saved in a single
+// transaction. The database is locked for as long as the store is open.
+type BoltStateStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStateStore opens or creates the database at a specified location.
+func NewBoltStateStore(location string) (*BoltStateStore, error) {
+	db, err := bolt.Open(location, 0600, &bolt.Options{Timeout: cacheLockWait})
+	if err != nil {
+		return nil, fmt.Errorf("state %s: %w", location, err)
+	}
+
+	return &BoltStateStore{db}, nil
+}
+
+// Load loads the state from the database.
+func (s *BoltStateStore) Load() (*State, error) {
+	state := newState()
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		version, err := strconv.Atoi(string(bucket.Get(boltKeyVersion)))
+		if err != nil || version != stateVersion {
+			return fmt.Errorf("state %s: unsupported version %q", s.db.Path(), bucket.Get(boltKeyVersion))
+		}
+
+		for key, value := range map[string]interface{}{
+			string(boltKeyEntries): &state.Entries,
+			string(boltKeyHistory): &state.History,
+			string(boltKeyZones):   &state.Zones,
+			string(boltKeyLastRun): &state.LastRun,
+			string(boltKeyRuns):    &state.Runs,
+			string(boltKeyVerify):  &state.LastVerification,
+			string(boltKeyPrints):  &state.Fingerprints,
+			string(boltKeySkipped): &state.Skipped,
+		} {
+			content := bucket.Get([]byte(key))
+			if content == nil {
+				continue
+			}
+
+			if err := json.Unmarshal(content, value); err != nil {
+				return fmt.Errorf("state %s: %s: %w", s.db.Path(), key, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Zones == nil {
+		state.Zones = make(map[string]ZoneSnapshot)
+	}
+
+	if state.Fingerprints == nil {
+		state.Fingerprints = make(map[string]string)
+	}
+
+	return state, nil
+}
+
+// Save stores the state in the database within a single transaction.
+func (s *BoltStateStore) Save(state *State) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltBucket)
+		if err != nil {
+			return err
+		}
+
+		err = bucket.Put(boltKeyVersion, []byte(strconv.Itoa(stateVersion)))
+		if err != nil {
+			return err
+		}
+
+		for key, value := range map[string]interface{}{
+			string(boltKeyEntries): state.Entries,
+			string(boltKeyHistory): state.History,
+			string(boltKeyZones):   state.Zones,
+			string(boltKeyLastRun): state.LastRun,
+			string(boltKeyRuns):    state.Runs,
+			string(boltKeyVerify):  state.LastVerification,
+			string(boltKeyPrints):  state.Fingerprints,
+			string(boltKeySkipped): state.Skipped,
+		} {
+			content, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put([]byte(key), content); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Unlock does nothing because the database is locked for as long as it is
+// open.
+func (s *BoltStateStore) Unlock() error {
+	return nil
+}
+
+// Close closes the database and releases its lock.
+func (s *BoltStateStore) Close() error {
+	return s.db.Close()
+}
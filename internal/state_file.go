@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// fileState represents the content of the state file.
+type fileState struct {
+	Version int `json:"version"`
+	*State
+}
+
+// FileStateStore stores the State in a JSON file. The file is replaced
+// atomically and protected by an advisory lock that is held from Load until
+// Save, so concurrent runs cannot overwrite each others changes.
+type FileStateStore struct {
+	location string
+	lock     *FileLock
+}
+
+// NewFileStateStore returns a FileStateStore for a specified location.
+func NewFileStateStore(location string) *FileStateStore {
+	return &FileStateStore{location: location}
+}
+
+// Load locks and loads the state from the file. When there is no file it
+// returns an empty state. Files in the old csv cache format are migrated.
+func (s *FileStateStore) Load() (*State, error) {
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+
+	state, err := s.load()
+	if err != nil {
+		s.Unlock()
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *FileStateStore) load() (*State, error) {
+	content, err := ioutil.ReadFile(s.location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newState(), nil
+		}
+		return nil, err
+	}
+
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return newState(), nil
+	}
+
+	if content[0] != '{' {
+		fileinfo, err := os.Stat(s.location)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.loadLegacy(bytes.NewReader(content), fileinfo.ModTime())
+	}
+
+	file := fileState{State: newState()}
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("cache %s: %w", s.location, err)
+	}
+
+	if file.Version != stateVersion {
+		return nil, fmt.Errorf("cache %s: unsupported version %d", s.location, file.Version)
+	}
+
+	if file.Zones == nil {
+		file.Zones = make(map[string]ZoneSnapshot)
+	}
+
+	if file.Fingerprints == nil {
+		file.Fingerprints = make(map[string]string)
+	}
+
+	return file.State, nil
+}
+
+func (s *FileStateStore) loadLegacy(r io.Reader, modified time.Time) (*State, error) {
+	state := newState()
+	state.legacy = make(map[string]legacyEntry)
+
+	// Lines with a wrong number of fields are skipped below instead of
+	// failing the whole file.
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cache %s: %w", s.location, err)
+	}
+
+	for _, record := range records {
+		if len(record) != 3 {
+			continue
+		}
+
+		state.legacy[record[0]] = legacyEntry{
+			ipv4:     record[1],
+			ipv6:     record[2],
+			modified: modified,
+		}
+	}
+
+	return state, nil
+}
+
+// Save stores the state in the file and releases the lock. The file is
+// replaced atomically, so an interrupted Save never corrupts it.
+func (s *FileStateStore) Save(state *State) error {
+	content, err := json.MarshalIndent(fileState{
+		Version: stateVersion,
+		State:   state,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.Unlock()
+
+	err = writeFileAtomic(s.location, content, 0600)
+	if err != nil {
+		return fmt.Errorf("cache %s: %w", s.location, err)
+	}
+
+	return nil
+}
+
+// Unlock releases the lock of the state file if it is held.
+func (s *FileStateStore) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+
+	err := s.lock.Release()
+	s.lock = nil
+	return err
+}
+
+// Close releases the lock of the state file. The file itself is only opened
+// while loading or saving.
+func (s *FileStateStore) Close() error {
+	return s.Unlock()
+}
+
+// acquire acquires the advisory lock of the state file unless it is held
+// already.
+func (s *FileStateStore) acquire() error {
+	if s.lock != nil {
+		return nil
+	}
+
+	lock, err := AcquireLock(s.location+".lock", cacheLockWait)
+	if err != nil {
+		return fmt.Errorf("cache %s: %w", s.location, err)
+	}
+
+	s.lock = lock
+	return nil
+}
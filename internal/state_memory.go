@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/json"
+)
+
+// MemoryStateStore keeps the State in memory only. It is useful for tests
+// and one-shot runs that should not leave anything behind.
+type MemoryStateStore struct {
+	content []byte
+}
+
+// NewMemoryStateStore returns an empty MemoryStateStore.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{}
+}
+
+// Load returns a copy of the saved state.
+func (s *MemoryStateStore) Load() (*State, error) {
+	state := newState()
+	if s.content == nil {
+		return state, nil
+	}
+
+	err := json.Unmarshal(s.content, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Save saves a copy of the state.
+func (s *MemoryStateStore) Save(state *State) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.content = content
+	return nil
+}
+
+// Unlock does nothing because the state is not shared.
+func (s *MemoryStateStore) Unlock() error {
+	return nil
+}
+
+// Close does nothing.
+func (s *MemoryStateStore) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Hentra/dyndns-netcup-go/pkg/netcup"
+)
+
+func TestStateStoreRoundtrip(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := CacheEntry{
+		Domain:       "example.de",
+		Host:         "www",
+		Type:         "A",
+		Value:        "203.0.113.1",
+		RecordID:     "1",
+		LastVerified: now,
+		LastChanged:  now.Add(-time.Hour),
+	}
+
+	want := &State{
+		Entries: []CacheEntry{entry},
+		History: []HistoryEntry{{"example.de", "www", "A", "203.0.113.1", now.Add(-time.Hour)}},
+		Zones: map[string]ZoneSnapshot{"example.de": {
+			Serial:  "2024050101",
+			Records: []netcup.DNSRecord{{ID: "1", Hostname: "www", Type: "A", Destination: "203.0.113.1"}},
+			Fetched: now,
+		}},
+		LastRun:          &RunResult{Started: now, Finished: now.Add(time.Second), Failures: []string{"domain example.com: loading zone"}},
+		Skipped:          []CacheEntry{{Domain: "example.de", Host: "@", Type: "AAAA", Value: "2001:db8::1", LastVerified: now}},
+		Fingerprints:     map[string]string{"example.de": "fingerprint"},
+		Runs:             3,
+		LastVerification: now.Add(-24 * time.Hour),
+	}
+
+	tests := []struct {
+		backend string
+		// reopen returns the store for the second load. The file and bolt
+		// stores are opened again to read what was persisted.
+		reopen bool
+	}{
+		{StateBackendFile, true},
+		{StateBackendBolt, true},
+		{StateBackendMemory, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.backend, func(t *testing.T) {
+			location := filepath.Join(t.TempDir(), "state")
+
+			store, err := NewStateStore(test.backend, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			empty, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(empty.Entries) != 0 || empty.Zones == nil || empty.Fingerprints == nil {
+				t.Errorf("Load() of an empty store = %+v", empty)
+			}
+
+			if err := store.Save(want); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.reopen {
+				if err := store.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if store, err = NewStateStore(test.backend, location); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer store.Close()
+
+			got, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewStateStore(t *testing.T) {
+	tests := []struct {
+		// backend is the value of IP-CACHE-BACKEND. It is not set if empty.
+		backend string
+		want    StateStore
+	}{
+		{"", &FileStateStore{}},
+		{StateBackendFile, &FileStateStore{}},
+		{StateBackendMemory, &MemoryStateStore{}},
+		{StateBackendBolt, &BoltStateStore{}},
+	}
+
+	for _, test := range tests {
+		config := defaultConfig()
+		config.IPCache = filepath.Join(t.TempDir(), "state")
+		if test.backend != "" {
+			if err := config.Set("IP-CACHE-BACKEND", test.backend); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		store, err := NewStateStore(config.IPCacheBackend, config.IPCache)
+		if err != nil {
+			t.Fatalf("backend %q: NewStateStore() error = %v", test.backend, err)
+		}
+		store.Close()
+
+		if reflect.TypeOf(store) != reflect.TypeOf(test.want) {
+			t.Errorf("backend %q: NewStateStore() = %T, want %T", test.backend, store, test.want)
+		}
+	}
+
+	if _, err := NewStateStore("redis", filepath.Join(t.TempDir(), "state")); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
@@ -68,7 +68,7 @@ func (c *Client) do(req *Request) (*Response, error) {
 		return nil, errors.New(response.getFormattedError())
 	}
 
-	logInfo(response.getFormattedStatus())
+	logInfo("%s", response.getFormattedStatus())
 
 	return &response, nil
 }
@@ -182,7 +182,47 @@ func (c *Client) UpdateDNSRecords(domainname string, dnsRecordSet *DNSRecordSet)
 	return nil
 }
 
+// ListAllDomains returns the names of all domains of the account. This
+// action is only available for reseller accounts.
+func (c *Client) ListAllDomains() ([]string, error) {
+	params, err := c.sessionParams()
+	if err != nil {
+		return nil, err
+	}
+
+	request := NewRequest("listallDomains", params)
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []DomainInfo
+	err = json.Unmarshal(response.ResponseData, &domains)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(domains))
+	for i, domain := range domains {
+		names[i] = domain.DomainName
+	}
+
+	return names, nil
+}
+
 func (c *Client) basicAuthParams(domainname string) (*Params, error) {
+	params, err := c.sessionParams()
+	if err != nil {
+		return nil, err
+	}
+
+	params.AddParam("domainname", domainname)
+
+	return params, nil
+}
+
+func (c *Client) sessionParams() (*Params, error) {
 	if c.APISessionid == "" {
 		return nil, ErrNoAPISessionid
 	}
@@ -191,7 +231,6 @@ func (c *Client) basicAuthParams(domainname string) (*Params, error) {
 	params.AddParam("apikey", c.APIKey)
 	params.AddParam("apisessionid", c.APISessionid)
 	params.AddParam("customernumber", strconv.Itoa(c.Customernumber))
-	params.AddParam("domainname", domainname)
 
 	return &params, nil
 }
@@ -22,6 +22,11 @@ type LoginResponse struct {
 	APISessionid string `json:"apisessionid"`
 }
 
+// DomainInfo represents a domain of an account.
+type DomainInfo struct {
+	DomainName string `json:"domainname"`
+}
+
 // DNSZone represents a dns zone.
 type DNSZone struct {
 	DomainName   string `json:"name"`
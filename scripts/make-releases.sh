@@ -13,7 +13,7 @@ rm -rf "$BIN_DIR/*"
 ARCHS="windows,amd64,windows.exe linux,amd64,linux linux,arm,linux-arm linux,arm64,linux-arm64 darwin,amd64,macos"
 
 for arch in $ARCHS; do IFS=","; set -- $arch
-    env GOOS=$1 GOARCH=$2 go build -o "$BIN_DIR/dyndns-netcup-go-$3" ./cmd/dyndns-netcup-go/main.go
+    env GOOS=$1 GOARCH=$2 go build -o "$BIN_DIR/dyndns-netcup-go-$3" ./cmd/dyndns-netcup-go
 done
 
 for file in "$BIN_DIR"/*; do 